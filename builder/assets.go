@@ -0,0 +1,143 @@
+package builder
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BrightLocal/FrontBuilder/builder/files"
+)
+
+// copyAssets copies the assets into the destination keeping their paths
+// relative to the source folder. Release builds add the content hash to
+// the file names except for the verbatim assets. Files imported by scripts
+// and stylesheets are left to the builds which emit or inline them
+func (b *Builder) copyAssets(paths []string) error {
+	for _, path := range paths {
+		asset := b.assets[path]
+		if b.isInput(path) {
+			delete(b.assetOutputs, asset.Path)
+			continue
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(asset.Path)
+		if b.releaseBuild && !b.isVerbatim(name) {
+			name = files.HashedName(name, content)
+		}
+		destination := filepath.Join(b.destination, filepath.FromSlash(name))
+		if existing, err := ioutil.ReadFile(destination); err != nil || !bytes.Equal(existing, content) {
+			if err := os.MkdirAll(filepath.Dir(destination), 0750); err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(destination, content, 0640); err != nil {
+				return err
+			}
+		}
+		b.assetOutputs[asset.Path] = newManifestEntry(name, content)
+		b.trackOutput(destination, content)
+	}
+	return nil
+}
+
+// isVerbatim reports whether the asset is copied under its own name, name
+// is slash separated path relative to the source folder
+func (b *Builder) isVerbatim(name string) bool {
+	return matchAsset(b.verbatim, name)
+}
+
+// privateAssets are project files which are not copied unless they are
+// listed in Assets: configs of tools and sources of other compilers
+var privateAssets = []string{
+	"package.json",
+	"package-lock.json",
+	"yarn.lock",
+	"tsconfig.json",
+	"jsconfig.json",
+	".scss",
+	".sass",
+	".less",
+	".vue",
+	".md",
+}
+
+// isPrivate reports whether the file is kept out of the destination, dot
+// files and files in dot folders are private as well
+func (b *Builder) isPrivate(name string) bool {
+	if matchAsset(b.publicAssets, name) {
+		return false
+	}
+	if strings.Contains(name, "/.") {
+		return true
+	}
+	for _, private := range privateAssets {
+		if strings.HasPrefix(private, ".") {
+			if strings.HasSuffix(name, private) {
+				return true
+			}
+		} else if path.Base(name) == private {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAsset reports whether any of the entries matches the asset name,
+// entries starting with a dot are extensions, others are files or folders
+// relative to the source folder
+func matchAsset(entries []string, name string) bool {
+	for _, entry := range entries {
+		if strings.HasPrefix(entry, ".") && !strings.Contains(entry, "/") {
+			if strings.HasSuffix(name, entry) {
+				return true
+			}
+			continue
+		}
+		entry = "/" + strings.Trim(filepath.ToSlash(entry), "/")
+		if name == entry || strings.HasPrefix(name, entry+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// assetOf reports whether the changed path is an asset collected by the last build
+func (b *Builder) assetOf(path string) bool {
+	if _, err := os.Stat(path); err != nil {
+		return false
+	}
+	_, ok := b.assets[filepath.Clean(path)]
+	return ok
+}
+
+// emittedFile returns the public path of the file the builds emitted for
+// the imported path
+func (b *Builder) emittedFile(path string) (string, bool) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	for _, build := range b.buildNames() {
+		for output, input := range b.emitted[build] {
+			if input == path {
+				return "/" + filepath.ToSlash(strings.TrimPrefix(output, b.destination)), true
+			}
+		}
+	}
+	return "", false
+}
+
+func (b *Builder) assetPaths() []string {
+	paths := make([]string, 0, len(b.assets))
+	for path := range b.assets {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -2,11 +2,13 @@ package builder
 
 import "github.com/evanw/esbuild/pkg/api"
 
+// esbuild logging is silenced, build messages are reported by the builder
+// in a stable order since apps are bundled concurrently
 var (
 	releaseBuildOptions = api.BuildOptions{
 		Bundle:            true,
 		Write:             true,
-		LogLevel:          api.LogLevelInfo,
+		LogLevel:          api.LogLevelSilent,
 		Sourcemap:         api.SourceMapLinked,
 		Target:            api.ESNext,
 		MinifyWhitespace:  true,
@@ -16,7 +18,7 @@ var (
 	devBuildOptions = api.BuildOptions{
 		Bundle:    true,
 		Write:     true,
-		LogLevel:  api.LogLevelInfo,
+		LogLevel:  api.LogLevelSilent,
 		Sourcemap: api.SourceMapNone,
 		Target:    api.ESNext,
 	}
@@ -1,13 +1,20 @@
 package builder
 
 import (
+	"context"
+	"crypto/md5"
 	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/BrightLocal/FrontBuilder/builder/files"
+	"github.com/BrightLocal/FrontBuilder/ignore"
 	"github.com/evanw/esbuild/pkg/api"
 )
 
@@ -23,14 +30,46 @@ type Builder struct {
 	indexFile        string
 	htmlExtension    string
 	scriptsPrefix    string
+	stylesPrefix     string
 	htmlPrefix       string
 	typeScriptConfig string
+	loaders          map[string]string
+	jsxFactory       string
+	jsxFragment      string
+	jsxImportSource  string
+	liveReload       string
+	ignore           *ignore.Matcher
+	incremental      bool
+	concurrency      int
 	scripts          map[string]sourcePath
 	typeScripts      map[string]sourcePath
+	styles           map[string]sourcePath
+	assets           map[string]sourcePath
+	assetOutputs     map[string]manifestEntry
+	verbatim         []string
+	publicAssets     []string
 	htmls            map[string]*files.HTML
 	jsApps           map[string]sourcePath
-	buildOptions     []api.BuildOptions
-	buildResult      []api.BuildResult
+	cssApps          map[string]sourcePath
+	unbundledStyles  map[string]string
+	entries          map[string]string
+	entryApps        map[string]sourcePath
+	entryScripts     map[string]*files.JS
+	pageSources      map[string]map[string]string
+	pageScripts      map[string]*files.JS
+	pairedStyles     map[string]*files.CSS
+	importedStyles   map[string]*files.CSS
+	splitting        bool
+	outbase          string
+	buildOptions     map[string]api.BuildOptions
+	bundles          map[string][]string
+	buildResult      map[string]api.BuildResult
+	contexts         map[string]func() api.BuildResult
+	inputs           map[string][]string
+	emitted          map[string]map[string]string
+	built            bool
+	outputHashes     map[string][md5.Size]byte
+	changedOutputs   []string
 }
 
 const (
@@ -49,13 +88,30 @@ func NewBuilder(sources []string, destination string, releaseBuild bool) *Builde
 		sources:          sources,
 		destination:      strings.TrimRight(destination, "/") + "/",
 		releaseBuild:     releaseBuild,
+		ignore:           ignore.Default(sources),
+		concurrency:      runtime.GOMAXPROCS(0),
 		indexFile:        defaultIndexFile,
 		htmlExtension:    defaultHTMLExtension,
 		typeScriptConfig: defaultTypeScriptConfig,
 		jsApps:           make(map[string]sourcePath),
+		cssApps:          make(map[string]sourcePath),
+		entryApps:        make(map[string]sourcePath),
+		entryScripts:     make(map[string]*files.JS),
+		pageSources:      make(map[string]map[string]string),
+		pageScripts:      make(map[string]*files.JS),
+		pairedStyles:     make(map[string]*files.CSS),
+		importedStyles:   make(map[string]*files.CSS),
 		htmls:            make(map[string]*files.HTML),
 		scripts:          make(map[string]sourcePath),
 		typeScripts:      make(map[string]sourcePath),
+		styles:           make(map[string]sourcePath),
+		assets:           make(map[string]sourcePath),
+		assetOutputs:     make(map[string]manifestEntry),
+		outputHashes:     make(map[string][md5.Size]byte),
+		buildResult:      make(map[string]api.BuildResult),
+		contexts:         make(map[string]func() api.BuildResult),
+		inputs:           make(map[string][]string),
+		emitted:          make(map[string]map[string]string),
 	}
 }
 
@@ -74,6 +130,13 @@ func (b *Builder) ScriptsPrefix(scriptsPrefix string) *Builder {
 	return b
 }
 
+// StylesPrefix sets the folder of the stylesheets paired with pages by name,
+// stylesheets imported from scripts are written next to the scripts
+func (b *Builder) StylesPrefix(stylesPrefix string) *Builder {
+	b.stylesPrefix = stylesPrefix
+	return b
+}
+
 func (b *Builder) HTMLPrefix(htmlPrefix string) *Builder {
 	b.htmlPrefix = htmlPrefix
 	return b
@@ -84,25 +147,239 @@ func (b *Builder) TypeScriptConfig(path string) *Builder {
 	return b
 }
 
+// Entries declares scripts by name, so that pages inject them at
+// <!--#APP:name#--> placeholders. Paths must be absolute and point to
+// scripts in the source folders
+func (b *Builder) Entries(entries map[string]string) *Builder {
+	b.entries = entries
+	return b
+}
+
+// Loaders assigns file, dataurl, text, base64 or json loader to extensions of files imported by
+// scripts and stylesheets, unknown loader names fail the build
+func (b *Builder) Loaders(loaders map[string]string) *Builder {
+	b.loaders = make(map[string]string)
+	for ext, name := range loaders {
+		b.loaders["."+strings.TrimLeft(ext, ".")] = name
+	}
+	return b
+}
+
+// JSX sets the functions JSX elements and fragments are compiled to,
+// React.createElement and React.Fragment are used if empty
+func (b *Builder) JSX(factory, fragment string) *Builder {
+	b.jsxFactory = factory
+	b.jsxFragment = fragment
+	return b
+}
+
+// JSXAutomaticRuntime creates JSX elements with the jsx-runtime of importSource,
+// react if empty, so that JSX modules don't need to import React
+func (b *Builder) JSXAutomaticRuntime(importSource string) *Builder {
+	if importSource == "" {
+		importSource = defaultJSXImportSource
+	}
+	b.jsxImportSource = importSource
+	return b
+}
+
+// Verbatim sets the assets which are copied without the content hash in
+// release builds, either extensions starting with a dot or paths relative
+// to the source folder
+func (b *Builder) Verbatim(verbatim []string) *Builder {
+	b.verbatim = verbatim
+	return b
+}
+
+// Assets sets the files which are copied although they are private like
+// dot files or configs of tools, entries are the same as of Verbatim
+func (b *Builder) Assets(assets []string) *Builder {
+	b.publicAssets = assets
+	return b
+}
+
+// Ignore sets the matcher of source files which are not collected,
+// only ignore.DefaultPatterns are excluded by default
+func (b *Builder) Ignore(matcher *ignore.Matcher) *Builder {
+	b.ignore = matcher
+	return b
+}
+
+// LiveReload injects the live reload client subscribed to eventsURL into
+// every page of a development build
+func (b *Builder) LiveReload(eventsURL string) *Builder {
+	b.liveReload = eventsURL
+	return b
+}
+
+// Incremental keeps esbuild build state of every app between builds, so that
+// subsequent builds only re-parse changed modules. Intended for watch mode
+func (b *Builder) Incremental(enabled bool) *Builder {
+	b.incremental = enabled
+	return b
+}
+
+// Concurrency limits the number of apps bundled at the same time,
+// GOMAXPROCS is used if limit is not positive
+func (b *Builder) Concurrency(limit int) *Builder {
+	if limit <= 0 {
+		limit = runtime.GOMAXPROCS(0)
+	}
+	b.concurrency = limit
+	return b
+}
+
+// Splitting builds all apps in a single esbuild call with code splitting,
+// so that code shared by the apps is written to the common chunks once.
+// Scripts are ES modules in this mode
+func (b *Builder) Splitting(enabled bool) *Builder {
+	b.splitting = enabled
+	return b
+}
+
+// ChangedOutputs returns URL paths of output files whose content was changed
+// by the last Build or BuildChanged
+func (b *Builder) ChangedOutputs() []string {
+	sort.Strings(b.changedOutputs)
+	return b.changedOutputs
+}
+
 func (b *Builder) Build() error {
+	return b.BuildContext(context.Background())
+}
+
+// BuildContext is Build which stops between the build steps once ctx is
+// cancelled and returns the context error then
+func (b *Builder) BuildContext(ctx context.Context) error {
+	b.changedOutputs = nil
+	b.built = false
 	if err := b.collectFiles(); err != nil {
 		return fmt.Errorf("error collecting files: %s", err)
 	}
-	b.prepareApps()
-	b.prepareBuildOptions()
-	b.build()
-	if err := b.checkBuildErrors(); err != nil {
+	if err := b.prepareApps(); err != nil {
+		return fmt.Errorf("error preparing apps: %s", err)
+	}
+	if err := b.prepareBuildOptions(); err != nil {
+		return fmt.Errorf("error preparing builds: %s", err)
+	}
+	b.disposeContexts()
+	if err := b.buildApps(ctx, b.buildNames(), b.assetPaths(), b.pageNames()); err != nil {
+		return err
+	}
+	if err := b.writeManifest(); err != nil {
+		return fmt.Errorf("error writing manifest: %s", err)
+	}
+	b.built = true
+	return nil
+}
+
+// BuildChanged rebuilds only the apps which import any of the changed paths
+// and re-renders their pages. Changed pages and pages including changed partials
+// are re-rendered with the scripts of the last build without bundling,
+// changed assets are copied again unless a bundle imports them. Changes the dependency graph of the last
+// build knows nothing about, e.g. new or removed files, fall back to a full Build.
+// Once ctx is cancelled it stops between the build steps and returns the context error
+func (b *Builder) BuildChanged(ctx context.Context, changed []string) error {
+	var sources, pages, assets []string
+	for _, path := range changed {
+		if dependents := b.pagesOf(path); len(dependents) > 0 {
+			for _, page := range dependents {
+				if !b.reparse(page) {
+					return b.BuildContext(ctx)
+				}
+				if !contains(pages, page) {
+					pages = append(pages, page)
+				}
+			}
+		} else if b.assetOf(path) && !b.isInput(path) {
+			assets = append(assets, filepath.Clean(path))
+		} else {
+			sources = append(sources, path)
+		}
+	}
+	builds, ok := b.affectedBuilds(sources)
+	if !ok {
+		return b.BuildContext(ctx)
+	}
+	b.changedOutputs = nil
+	if err := b.copyAssets(assets); err != nil {
+		return fmt.Errorf("error copying assets: %s", err)
+	}
+	rebuilt := make(map[string]struct{})
+	var apps []string
+	for _, build := range builds {
+		for _, app := range b.bundles[build] {
+			if _, ok := rebuilt[app]; !ok {
+				rebuilt[app] = struct{}{}
+				apps = append(apps, app)
+			}
+		}
+	}
+	if len(builds) > 0 {
+		sort.Strings(apps)
+		if err := b.buildApps(ctx, builds, nil, apps); err != nil {
+			return err
+		}
+	}
+	var render []string
+	for _, page := range pages {
+		if _, ok := rebuilt[page]; !ok {
+			render = append(render, page)
+		}
+	}
+	if err := b.renderHTMLFiles(render); err != nil {
+		return fmt.Errorf("error processing HTMLs: %s", err)
+	}
+	if err := b.writeManifest(); err != nil {
+		return fmt.Errorf("error writing manifest: %s", err)
+	}
+	return nil
+}
+
+// buildApps bundles the builds, copies the assets none of the bundles
+// imports and renders the pages
+func (b *Builder) buildApps(ctx context.Context, builds, assets, pages []string) error {
+	if err := b.build(ctx, builds); err != nil {
+		return err
+	}
+	if err := b.checkBuildErrors(builds); err != nil {
 		return fmt.Errorf("build failed: %s", err)
 	}
-	if err := b.processHTMLFiles(); err != nil {
+	for _, build := range builds {
+		for _, file := range b.buildResult[build].OutputFiles {
+			b.trackOutput(file.Path, file.Contents)
+		}
+	}
+	if err := b.copyAssets(assets); err != nil {
+		return fmt.Errorf("error copying assets: %s", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := b.processHTMLFiles(pages); err != nil {
 		return fmt.Errorf("error processing HTMLs: %s", err)
 	}
 	return nil
 }
 
 func (b *Builder) collectFiles() error {
+	b.scripts = make(map[string]sourcePath)
+	b.typeScripts = make(map[string]sourcePath)
+	b.styles = make(map[string]sourcePath)
+	b.assets = make(map[string]sourcePath)
+	b.assetOutputs = make(map[string]manifestEntry)
+	b.htmls = make(map[string]*files.HTML)
 	for _, source := range b.sources {
 		if err := filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if path != source && b.ignore.Match(path, info.IsDir()) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
 			if info.IsDir() {
 				return nil
 			}
@@ -114,21 +391,49 @@ func (b *Builder) collectFiles() error {
 			return err
 		}
 	}
+	b.removePartials()
 	return nil
 }
 
+// removePartials drops files included by the pages, so that they are
+// neither rendered as pages nor copied as assets
+func (b *Builder) removePartials() {
+	partials := make(map[string]struct{})
+	for _, html := range b.htmls {
+		for _, include := range html.Includes() {
+			partials[include] = struct{}{}
+		}
+	}
+	for name, html := range b.htmls {
+		if _, ok := partials[html.Source()]; ok {
+			delete(b.htmls, name)
+		}
+	}
+	for path := range b.assets {
+		if _, ok := partials[path]; ok {
+			delete(b.assets, path)
+		}
+	}
+}
+
 func (b *Builder) collectFileTypes(fileInfo os.FileInfo, source, path string) error {
+	_, isScript := scriptLoaders[filepath.Ext(fileInfo.Name())]
 	switch {
-	case strings.HasSuffix(fileInfo.Name(), ".js"):
+	case isScript && !isTypeScript(fileInfo.Name()):
 		b.scripts[path] = sourcePath{
 			BaseDir: source,
 			Path:    strings.TrimPrefix(path, source),
 		}
-	case strings.HasSuffix(fileInfo.Name(), ".ts"):
+	case isScript:
 		b.typeScripts[path] = sourcePath{
 			BaseDir: source,
 			Path:    strings.TrimPrefix(path, source),
 		}
+	case strings.HasSuffix(fileInfo.Name(), ".css"):
+		b.styles[path] = sourcePath{
+			BaseDir: source,
+			Path:    strings.TrimPrefix(path, source),
+		}
 	case strings.HasSuffix(fileInfo.Name(), b.htmlExtension):
 		name := strings.TrimPrefix(path, source)
 		if _, ok := b.htmls[name]; ok {
@@ -136,73 +441,443 @@ func (b *Builder) collectFileTypes(fileInfo os.FileInfo, source, path string) er
 				return errors.New("duplicate source: " + name)
 			}
 		}
-		b.htmls[name] = files.NewHTML(filepath.Join(source, strings.TrimPrefix(path, source)))
+		html := files.NewHTML(filepath.Join(source, strings.TrimPrefix(path, source))).IncludeRoots(b.sources)
+		if err := html.Parse(); err != nil {
+			return err
+		}
+		b.htmls[name] = html
+	default:
+		asset := sourcePath{
+			BaseDir: source,
+			Path:    strings.TrimPrefix(path, source),
+		}
+		if b.isPrivate(filepath.ToSlash(asset.Path)) {
+			return nil
+		}
+		b.assets[path] = asset
 	}
 	return nil
 }
 
-func (b *Builder) prepareApps() {
-	for _, script := range b.scripts {
-		html := strings.TrimSuffix(script.Path, ".js") + b.htmlExtension
-		if _, ok := b.htmls[html]; ok {
+func (b *Builder) prepareApps() error {
+	b.jsApps = make(map[string]sourcePath)
+	b.pageScripts = make(map[string]*files.JS)
+	b.entryScripts = make(map[string]*files.JS)
+	b.pairedStyles = make(map[string]*files.CSS)
+	b.importedStyles = make(map[string]*files.CSS)
+	for _, scripts := range []map[string]sourcePath{b.scripts, b.typeScripts} {
+		for _, script := range scripts {
+			html := strings.TrimSuffix(script.Path, filepath.Ext(script.Path)) + b.htmlExtension
+			if _, ok := b.htmls[html]; !ok {
+				continue
+			}
+			if prev, ok := b.jsApps[html]; ok && scriptPriority(prev.Path) > scriptPriority(script.Path) {
+				continue
+			}
 			b.jsApps[html] = script
 		}
 	}
-	for _, script := range b.typeScripts {
-		html := strings.TrimSuffix(script.Path, ".ts") + b.htmlExtension
-		if _, ok := b.htmls[html]; ok {
-			b.jsApps[html] = script
+	b.cssApps = make(map[string]sourcePath)
+	b.unbundledStyles = make(map[string]string)
+	for path, style := range b.styles {
+		html := strings.TrimSuffix(style.Path, ".css") + b.htmlExtension
+		if _, ok := b.htmls[html]; !ok {
+			// stylesheets of no page are copied unless a bundle imports them
+			b.assets[path] = style
+			continue
 		}
+		if script, ok := b.jsApps[html]; ok && b.stylesPrefix == b.scriptsPrefix {
+			b.unbundledStyles[path] = html
+			log.Printf("Warning: %s is not bundled for %s, it would overwrite the styles imported by %s; "+
+				"import it from the script or set styles_prefix", path, html, script.Path)
+			continue
+		}
+		b.cssApps[html] = style
 	}
+	return b.prepareEntries()
 }
 
-func (b *Builder) prepareBuildOptions() {
-	var buildOptions []api.BuildOptions
-	b.buildOptions = []api.BuildOptions{}
-	for _, jsFile := range b.jsApps {
+// prepareEntries finds the scripts of the declared entries and makes sure
+// every named placeholder refers to one of them. Scripts the pages declare
+// themselves become entries named by the src: prefixed script path
+func (b *Builder) prepareEntries() error {
+	b.entryApps = make(map[string]sourcePath)
+	b.pageSources = make(map[string]map[string]string)
+	for name, path := range b.entries {
+		script, ok := b.scriptOf(path)
+		if !ok {
+			return fmt.Errorf("entry %q: %s is not a script in the source folders", name, path)
+		}
+		b.entryApps[name] = script
+	}
+	for _, page := range b.pageNames() {
+		html := b.htmls[page]
+		for _, name := range html.Entries() {
+			if _, ok := b.entryApps[name]; !ok {
+				return fmt.Errorf("%s: unknown entry %q", html.Source(), name)
+			}
+		}
+		for _, src := range html.Sources() {
+			path, script, ok := b.findScript(html.Source(), src)
+			if !ok {
+				return fmt.Errorf("%s: %q is not a script in the source folders", html.Source(), src)
+			}
+			if b.pageSources[page] == nil {
+				b.pageSources[page] = make(map[string]string)
+			}
+			b.pageSources[page][src] = sourceEntryPrefix + path
+			b.entryApps[sourceEntryPrefix+path] = script
+		}
+	}
+	return nil
+}
+
+// sourceEntryPrefix starts names of the entries declared by the pages,
+// declared entry names can't contain the colon
+const sourceEntryPrefix = "src:"
+
+func (b *Builder) scriptOf(path string) (sourcePath, bool) {
+	if script, ok := b.scripts[path]; ok {
+		return script, true
+	}
+	script, ok := b.typeScripts[path]
+	return script, ok
+}
+
+// findScript resolves src of the page placeholder, paths starting with
+// a slash are looked up in all the source folders, others relative to the page
+func (b *Builder) findScript(page, src string) (string, sourcePath, bool) {
+	var candidates []string
+	if strings.HasPrefix(src, "/") {
+		for _, source := range b.sources {
+			candidates = append(candidates, filepath.Join(source, filepath.FromSlash(src)))
+		}
+	} else {
+		candidates = append(candidates, filepath.Join(filepath.Dir(page), filepath.FromSlash(src)))
+	}
+	for _, path := range candidates {
+		if script, ok := b.scriptOf(path); ok {
+			return path, script, true
+		}
+	}
+	return "", sourcePath{}, false
+}
+
+// prepareBuildOptions makes one build of every app, or a single build of all
+// the apps in splitting mode, and one build of every stylesheet paired with a page
+func (b *Builder) prepareBuildOptions() error {
+	b.buildOptions = make(map[string]api.BuildOptions)
+	b.bundles = make(map[string][]string)
+	if b.splitting {
+		b.outbase = b.scriptsBase()
+	}
+	builds := make(map[string]string)
+	for _, html := range b.appNames() {
+		jsFile := b.jsApps[html]
+		name := html
+		if b.splitting {
+			name = b.outbase
+		}
+		b.addScriptBuild(name, jsFile)
+		builds[filepath.Join(jsFile.BaseDir, jsFile.Path)] = name
+		b.bundles[name] = append(b.bundles[name], html)
+	}
+	entryPages := b.entryPages()
+	for _, entry := range b.entryNames() {
+		jsFile := b.entryApps[entry]
+		path := filepath.Join(jsFile.BaseDir, jsFile.Path)
+		name, ok := builds[path]
+		if !ok {
+			name = path
+			if b.splitting {
+				name = b.outbase
+			}
+			b.addScriptBuild(name, jsFile)
+			builds[path] = name
+		}
+		for _, page := range entryPages[entry] {
+			if !contains(b.bundles[name], page) {
+				b.bundles[name] = append(b.bundles[name], page)
+			}
+		}
+		if _, ok := b.bundles[name]; !ok {
+			// declared entries are built even if no page uses them
+			b.bundles[name] = nil
+		}
+	}
+	for html, cssFile := range b.cssApps {
+		name := filepath.Join(cssFile.BaseDir, cssFile.Path)
 		buildOption := b.getDefaultBuildOption()
-		buildOption.Outdir = filepath.Join(b.destination, b.scriptsPrefix, filepath.Dir(jsFile.Path))
-		buildOption.EntryPoints = []string{filepath.Join(jsFile.BaseDir, jsFile.Path)}
-		if strings.HasSuffix(jsFile.Path, ".ts") {
-			buildOption.Loader = map[string]api.Loader{".ts": api.LoaderTS}
-			buildOption.Tsconfig = b.typeScriptConfig
+		buildOption.Outdir = filepath.Join(b.destination, b.stylesPrefix, filepath.Dir(cssFile.Path))
+		buildOption.EntryPoints = []string{name}
+		buildOption.PublicPath = b.publicPath(buildOption.Outdir)
+		b.buildOptions[name] = buildOption
+		b.bundles[name] = []string{html}
+	}
+	loaders, err := b.buildLoaders()
+	if err != nil {
+		return err
+	}
+	for name, buildOption := range b.buildOptions {
+		buildOption.Loader = loaders
+		buildOption.Metafile = metafilePath(buildOption)
+		b.buildOptions[name] = buildOption
+	}
+	for name := range b.buildResult {
+		if _, ok := b.buildOptions[name]; !ok {
+			delete(b.buildResult, name)
+			delete(b.inputs, name)
+			delete(b.emitted, name)
 		}
-		buildOptions = append(buildOptions, buildOption)
 	}
-	b.buildOptions = buildOptions
+	return nil
 }
 
-func (b *Builder) build() {
-	b.buildResult = []api.BuildResult{}
-	for _, buildOption := range b.buildOptions {
-		b.buildResult = append(b.buildResult, api.Build(buildOption))
+// addScriptBuild adds the script to the entry points of the named build
+func (b *Builder) addScriptBuild(name string, jsFile sourcePath) {
+	buildOption, ok := b.buildOptions[name]
+	if !ok {
+		buildOption = b.getDefaultBuildOption()
+		if b.splitting {
+			buildOption.Outdir = filepath.Join(b.destination, b.scriptsPrefix)
+			buildOption.Outbase = b.outbase
+			buildOption.Splitting = true
+			buildOption.Format = api.FormatESModule
+		} else {
+			buildOption.Outdir = filepath.Join(b.destination, b.scriptsPrefix, filepath.Dir(jsFile.Path))
+		}
+	}
+	buildOption.EntryPoints = append(buildOption.EntryPoints, filepath.Join(jsFile.BaseDir, jsFile.Path))
+	buildOption.PublicPath = b.publicPath(buildOption.Outdir)
+	if isTypeScript(jsFile.Path) {
+		buildOption.Tsconfig = b.typeScriptConfig
 	}
+	b.setJSXOptions(&buildOption)
+	b.buildOptions[name] = buildOption
 }
 
-func (b *Builder) checkBuildErrors() error {
-	for _, result := range b.buildResult {
-		if len(result.Errors) > 0 {
-			for _, err := range result.Errors {
-				if err.Location != nil {
-					fmt.Printf("Error in %s:%d: %s\n", err.Location.File, err.Location.Line, err.Text)
-				}
+// scriptsBase returns the closest folder containing all the scripts
+// of apps and entries, the output base of the splitting build
+func (b *Builder) scriptsBase() string {
+	var base string
+	for _, scripts := range []map[string]sourcePath{b.jsApps, b.entryApps} {
+		for _, script := range scripts {
+			dir, err := filepath.Abs(script.BaseDir)
+			if err != nil {
+				dir = script.BaseDir
+			}
+			if base == "" {
+				base = dir
+				continue
+			}
+			for !isWithin(base, dir) && base != filepath.Dir(base) {
+				base = filepath.Dir(base)
+			}
+		}
+	}
+	return base
+}
+
+// isWithin reports whether path is dir or one of its descendants
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// scriptOutput returns the path of the built script, in splitting mode
+// it is relative to the folder containing all the scripts
+func (b *Builder) scriptOutput(jsFile sourcePath) string {
+	name := strings.TrimSuffix(jsFile.Path, filepath.Ext(jsFile.Path)) + ".js"
+	if b.splitting {
+		if dir, err := filepath.Abs(jsFile.BaseDir); err == nil {
+			if rel, err := filepath.Rel(b.outbase, dir); err == nil {
+				name = filepath.Join(rel, name)
 			}
-			return errors.New("errors on build process. check above messages")
 		}
 	}
+	return filepath.Join(b.destination, b.scriptsPrefix, name)
+}
+
+// build runs the builds concurrently, esbuild can't be interrupted,
+// so cancellation stops starting new builds only
+func (b *Builder) build(ctx context.Context, builds []string) error {
+	results := make([]*api.BuildResult, len(builds))
+	limit := make(chan struct{}, b.concurrency)
+	var wg sync.WaitGroup
+schedule:
+	for i, build := range builds {
+		select {
+		case <-ctx.Done():
+			break schedule
+		case limit <- struct{}{}:
+		}
+		buildOption := b.buildOptions[build]
+		rebuild := b.contexts[contextKey(buildOption)]
+		wg.Add(1)
+		go func(i int, buildOption api.BuildOptions, rebuild func() api.BuildResult) {
+			defer wg.Done()
+			defer func() { <-limit }()
+			var result api.BuildResult
+			switch {
+			case !b.incremental:
+				result = api.Build(buildOption)
+			case rebuild != nil:
+				result = rebuild()
+			default:
+				buildOption.Incremental = true
+				result = api.Build(buildOption)
+			}
+			results[i] = &result
+		}(i, buildOption, rebuild)
+	}
+	wg.Wait()
+	for i, build := range builds {
+		if results[i] == nil {
+			continue
+		}
+		buildOption := b.buildOptions[build]
+		if key := contextKey(buildOption); b.incremental && b.contexts[key] == nil {
+			b.contexts[key] = results[i].Rebuild
+		}
+		b.buildResult[build] = *results[i]
+		if inputs, emitted, ok := b.extractMetafile(build, buildOption.Metafile); ok {
+			b.inputs[build] = inputs
+			b.emitted[build] = emitted
+		}
+	}
+	return ctx.Err()
+}
+
+// disposeContexts drops incremental build state of the apps which are gone.
+// esbuild keeps the state in the rebuild closure only, so releasing
+// the closure is all it takes to free it
+func (b *Builder) disposeContexts() {
+	used := make(map[string]struct{})
+	for _, buildOption := range b.buildOptions {
+		used[contextKey(buildOption)] = struct{}{}
+	}
+	for key := range b.contexts {
+		if _, ok := used[key]; !ok {
+			delete(b.contexts, key)
+		}
+	}
+}
+
+func contextKey(buildOption api.BuildOptions) string {
+	return buildOption.Outdir + "\x00" + strings.Join(buildOption.EntryPoints, "\x00")
+}
+
+// checkBuildErrors reports messages in the order of builds, so that
+// the output of concurrent builds is stable
+func (b *Builder) checkBuildErrors(builds []string) error {
+	failed := false
+	for _, build := range builds {
+		result := b.buildResult[build]
+		for _, warning := range result.Warnings {
+			printMessage("Warning", warning)
+		}
+		for _, err := range result.Errors {
+			printMessage("Error", err)
+		}
+		failed = failed || len(result.Errors) > 0
+	}
+	if failed {
+		return errors.New("errors on build process. check above messages")
+	}
 	return nil
 }
 
-func (b *Builder) processHTMLFiles() error {
+func printMessage(kind string, message api.Message) {
+	if message.Location != nil {
+		fmt.Printf("%s in %s:%d: %s\n", kind, message.Location.File, message.Location.Line, message.Text)
+	} else {
+		fmt.Printf("%s: %s\n", kind, message.Text)
+	}
+}
+
+func (b *Builder) processHTMLFiles(pages []string) error {
 	resultFiles := b.resultFiles()
-	for path, html := range b.htmls {
-		script := strings.TrimSuffix(filepath.Join(b.destination, b.scriptsPrefix, path), b.htmlExtension) + ".js"
-		if content, ok := resultFiles[script]; ok {
-			html.InjectJS(files.NewJS(b.destination, script, content))
+	// pages share the script of an entry, so that it is renamed once
+	scripts := make(map[string]*files.JS)
+	jsOf := func(script string) (*files.JS, bool) {
+		if js, ok := scripts[script]; ok {
+			return js, true
 		}
-		if err := html.Render(filepath.Join(b.destination, b.htmlPrefix, path), b.releaseBuild); err != nil {
+		content, ok := resultFiles[script]
+		if !ok {
+			return nil, false
+		}
+		scripts[script] = files.NewJS(b.destination, script, content).Module(b.splitting)
+		return scripts[script], true
+	}
+	// entries are resolved by references of any page, not only by their placeholders
+	for entry, jsFile := range b.entryApps {
+		if js, ok := jsOf(b.scriptOutput(jsFile)); ok {
+			b.entryScripts[entry] = js
+		}
+	}
+	for _, path := range pages {
+		html := b.htmls[path]
+		if jsFile, ok := b.jsApps[path]; ok {
+			if js, ok := jsOf(b.scriptOutput(jsFile)); ok {
+				b.pageScripts[path] = js
+				html.InjectJS(js)
+			}
+		}
+		for _, entry := range html.Entries() {
+			if js, ok := b.entryScripts[entry]; ok {
+				html.InjectEntry(entry, js)
+			}
+		}
+		for src, entry := range b.pageSources[path] {
+			if js, ok := b.entryScripts[entry]; ok {
+				html.InjectSource(src, js)
+			}
+		}
+		var styles []*files.CSS
+		paired, imported := b.pageStyles(path)
+		if _, ok := b.cssApps[path]; ok {
+			if content, ok := resultFiles[paired]; ok {
+				css := files.NewCSS(b.destination, paired, content)
+				b.pairedStyles[path] = css
+				styles = append(styles, css)
+			}
+		}
+		if _, ok := b.jsApps[path]; ok {
+			if content, ok := resultFiles[imported]; ok {
+				css := files.NewCSS(b.destination, imported, content)
+				b.importedStyles[path] = css
+				styles = append(styles, css)
+			}
+		}
+		html.InjectCSS(styles...)
+		page := path
+		html.ResolveReferences(func(ref string) (string, error) {
+			return b.resolveReference(page, ref)
+		})
+		if b.liveReload != "" && !b.releaseBuild {
+			html.LiveReload(b.liveReload)
+		}
+	}
+	return b.renderHTMLFiles(pages)
+}
+
+// pageStyles returns paths of the stylesheet paired with the page
+// and of the stylesheet imported from its script
+func (b *Builder) pageStyles(page string) (string, string) {
+	paired := filepath.Join(b.destination, b.stylesPrefix, strings.TrimSuffix(page, b.htmlExtension)+".css")
+	return paired, strings.TrimSuffix(b.scriptOutput(b.jsApps[page]), ".js") + ".css"
+}
+
+// renderHTMLFiles renders pages with the scripts injected by the last build
+func (b *Builder) renderHTMLFiles(pages []string) error {
+	for _, path := range pages {
+		html := b.htmls[path]
+		destination := filepath.Join(b.destination, b.htmlPrefix, path)
+		if err := html.Render(destination, b.releaseBuild); err != nil {
 			return err
 		}
+		b.trackOutput(destination, html.Output())
 	}
 	return nil
 }
@@ -223,3 +898,14 @@ func (b *Builder) resultFiles() map[string][]byte {
 	}
 	return htmlScripts
 }
+
+// trackOutput remembers content hash of the output file and marks it
+// as changed if it differs from the previous build
+func (b *Builder) trackOutput(path string, content []byte) {
+	hash := md5.Sum(content)
+	if prev, ok := b.outputHashes[path]; ok && prev == hash {
+		return
+	}
+	b.outputHashes[path] = hash
+	b.changedOutputs = append(b.changedOutputs, "/"+filepath.ToSlash(strings.TrimPrefix(path, b.destination)))
+}
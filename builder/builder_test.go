@@ -1,12 +1,18 @@
 package builder
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/BrightLocal/FrontBuilder/builder/files"
+	"github.com/BrightLocal/FrontBuilder/ignore"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -205,3 +211,731 @@ func TestCollect(t *testing.T) {
 		})
 	}
 }
+
+func TestChangedOutputs(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{
+		"app.html": "<html><head><!--#APP#--></head><body></body></html>",
+		"app.js":   "import './app.css';\nconsole.log('app');\n",
+		"app.css":  "body { color: red; }\n",
+	})
+	b := NewBuilder([]string{source}, destination, false)
+	if assert.NoError(t, b.Build()) {
+		assert.Equal(t, []string{"/app.css", "/app.html", "/app.js"}, b.ChangedOutputs())
+	}
+	if assert.NoError(t, b.Build()) {
+		assert.Empty(t, b.ChangedOutputs())
+	}
+	writeFiles(t, source, map[string]string{"app.css": "body { color: blue; }\n"})
+	if assert.NoError(t, b.Build()) {
+		assert.Equal(t, []string{"/app.css"}, b.ChangedOutputs())
+	}
+}
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestIncrementalBuild(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{
+		"app.html": "<!--#APP#-->",
+		"app.js":   "import {name} from './lib';\nconsole.log(name);\n",
+		"lib.js":   "export const name = 'first';\n",
+	})
+	b := NewBuilder([]string{source}, destination, false).Incremental(true)
+	if !assert.NoError(t, b.Build()) {
+		return
+	}
+	assert.Len(t, b.contexts, 1)
+	writeFiles(t, source, map[string]string{
+		"lib.js":     "export const name = 'second';\n",
+		"other.html": "<!--#APP#-->",
+		"other.js":   "console.log('other');\n",
+	})
+	if assert.NoError(t, b.Build()) {
+		assert.Len(t, b.contexts, 2)
+		if content, err := ioutil.ReadFile(filepath.Join(destination, "app.js")); assert.NoError(t, err) {
+			assert.Contains(t, string(content), "second")
+		}
+	}
+	if !assert.NoError(t, os.Remove(filepath.Join(source, "other.js"))) {
+		return
+	}
+	if assert.NoError(t, b.Build()) {
+		assert.Len(t, b.contexts, 1)
+	}
+}
+
+func TestBuildChanged(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{
+		"a.html":      "<!--#APP#-->",
+		"a.js":        "import {name} from './lib/name';\nconsole.log(name);\n",
+		"b.html":      "<!--#APP#-->",
+		"b.js":        "console.log('b');\n",
+		"lib/name.js": "export const name = 'first';\n",
+	})
+	b := NewBuilder([]string{source}, destination, false)
+	if !assert.NoError(t, b.Build()) {
+		return
+	}
+	lib := filepath.Join(source, "lib", "name.js")
+	builds, ok := b.affectedBuilds([]string{lib})
+	assert.True(t, ok)
+	assert.Equal(t, []string{"/a.html"}, builds)
+	_, ok = b.affectedBuilds([]string{filepath.Join(source, "c.js")})
+	assert.False(t, ok)
+	writeFiles(t, source, map[string]string{"lib/name.js": "export const name = 'second';\n"})
+	if assert.NoError(t, b.BuildChanged(context.Background(), []string{lib})) {
+		assert.Equal(t, []string{"/a.js"}, b.ChangedOutputs())
+		if content, err := ioutil.ReadFile(filepath.Join(destination, "a.js")); assert.NoError(t, err) {
+			assert.Contains(t, string(content), "second")
+		}
+	}
+}
+
+func TestBuildChangedHTMLOnly(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{
+		"a.html": "<!--#APP#-->",
+		"a.js":   "console.log('a');\n",
+	})
+	b := NewBuilder([]string{source}, destination, false)
+	if !assert.NoError(t, b.Build()) {
+		return
+	}
+	if !assert.NoError(t, os.Remove(filepath.Join(destination, "a.js"))) {
+		return
+	}
+	writeFiles(t, source, map[string]string{"a.html": "<title>A</title><!--#APP#-->"})
+	if assert.NoError(t, b.BuildChanged(context.Background(), []string{filepath.Join(source, "a.html")})) {
+		assert.Equal(t, []string{"/a.html"}, b.ChangedOutputs())
+		assert.NoFileExists(t, filepath.Join(destination, "a.js"))
+		if content, err := ioutil.ReadFile(filepath.Join(destination, "a.html")); assert.NoError(t, err) {
+			assert.Equal(t, `<title>A</title><script src="/a.js"></script>`, string(content))
+		}
+	}
+}
+
+func TestCollectIgnored(t *testing.T) {
+	source := t.TempDir()
+	writeFiles(t, source, map[string]string{
+		"app.html":                  "<!--#APP#-->",
+		"app.ts":                    "console.log('app');\n",
+		".app.ts.swp":               "",
+		"node_modules/lib/index.js": "module.exports = {};\n",
+		"drafts/draft.html":         "<!--#APP#-->",
+		"drafts/draft.js":           "console.log('draft');\n",
+	})
+	matcher, err := ignore.New([]string{source}, []string{"drafts/"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	b := NewBuilder([]string{source}, t.TempDir(), false).Ignore(matcher)
+	if assert.NoError(t, b.collectFiles()) {
+		assert.Empty(t, b.scripts)
+		assert.Len(t, b.typeScripts, 1)
+		assert.Len(t, b.htmls, 1)
+	}
+}
+
+func TestBuildCancelled(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{
+		"a.html": "<!--#APP#-->",
+		"a.js":   "console.log('a');\n",
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b := NewBuilder([]string{source}, destination, false)
+	assert.Equal(t, context.Canceled, b.BuildContext(ctx))
+	assert.NoFileExists(t, filepath.Join(destination, "a.html"))
+	if assert.NoError(t, b.BuildChanged(context.Background(), []string{filepath.Join(source, "a.js")})) {
+		assert.FileExists(t, filepath.Join(destination, "a.html"))
+	}
+}
+
+func TestConcurrentBuild(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	sources := make(map[string]string)
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		sources[name+".html"] = "<!--#APP#-->"
+		sources[name+".js"] = "console.log('" + name + "');\n"
+	}
+	writeFiles(t, source, sources)
+	b := NewBuilder([]string{source}, destination, false).Concurrency(2)
+	if assert.NoError(t, b.Build()) {
+		assert.Equal(t, []string{
+			"/a.html", "/a.js", "/b.html", "/b.js", "/c.html", "/c.js", "/d.html", "/d.js", "/e.html", "/e.js",
+		}, b.ChangedOutputs())
+	}
+	writeFiles(t, source, map[string]string{"c.js": "import './missing';\n"})
+	assert.Error(t, b.Build())
+}
+
+func TestSplittingBuild(t *testing.T) {
+	for _, release := range []bool{false, true} {
+		source, destination := t.TempDir(), t.TempDir()
+		writeFiles(t, source, map[string]string{
+			"a.html":        "<!--#APP#-->",
+			"a.js":          "import {shared} from './lib/shared';\nconsole.log('a', shared());\n",
+			"b/b.html":      "<!--#APP#-->",
+			"b/b.js":        "import {shared} from '../lib/shared';\nconsole.log('b', shared());\n",
+			"lib/shared.js": "export function shared() { return 'shared library code'; }\n",
+		})
+		b := NewBuilder([]string{source}, destination, release).ScriptsPrefix("js/").Splitting(true)
+		if !assert.NoError(t, b.Build()) {
+			continue
+		}
+		assert.Len(t, b.buildOptions, 1)
+		chunks, err := filepath.Glob(filepath.Join(destination, "js", "chunk.*.js"))
+		if assert.NoError(t, err) && assert.Len(t, chunks, 1) {
+			content, _ := ioutil.ReadFile(chunks[0])
+			assert.Contains(t, string(content), "shared library code")
+		}
+		for _, page := range []string{"a.html", "b/b.html"} {
+			if content, err := ioutil.ReadFile(filepath.Join(destination, page)); assert.NoError(t, err) {
+				assert.Contains(t, string(content), `<script type="module" src="/js/`)
+			}
+		}
+	}
+
+	// apps of several source folders share the chunks as well
+	root, destination := t.TempDir(), t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"one/a.html":    "<!--#APP#-->",
+		"one/a.js":      "import {shared} from '../lib/shared';\nconsole.log('a', shared());\n",
+		"two/b.html":    "<!--#APP#-->",
+		"two/b.js":      "import {shared} from '../lib/shared';\nconsole.log('b', shared());\n",
+		"lib/shared.js": "export function shared() { return 'shared library code'; }\n",
+	})
+	sources := []string{filepath.Join(root, "one"), filepath.Join(root, "two")}
+	b := NewBuilder(sources, destination, false).ScriptsPrefix("js/").Splitting(true)
+	if !assert.NoError(t, b.Build()) {
+		return
+	}
+	assert.Len(t, b.buildOptions, 1)
+	chunks, _ := filepath.Glob(filepath.Join(destination, "js", "chunk.*.js"))
+	assert.Len(t, chunks, 1)
+	if content, err := ioutil.ReadFile(filepath.Join(destination, "a.html")); assert.NoError(t, err) {
+		assert.Equal(t, `<script type="module" src="/js/one/a.js"></script>`, string(content))
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(destination, "b.html")); assert.NoError(t, err) {
+		assert.Equal(t, `<script type="module" src="/js/two/b.js"></script>`, string(content))
+	}
+}
+
+func TestStylesBuild(t *testing.T) {
+	for _, release := range []bool{false, true} {
+		source, destination := t.TempDir(), t.TempDir()
+		writeFiles(t, source, map[string]string{
+			"a.html":         "<head><!--#STYLES#--></head><!--#APP#-->",
+			"a.js":           "import './a-imported.css';\nconsole.log('a');\n",
+			"a.css":          "@import './lib/base.css';\nbody { color: red; }\n",
+			"a-imported.css": "p { margin: 0; }\n",
+			"lib/base.css":   "html { padding: 0; }\n",
+			"b.html":         "<head><!--#STYLES#--></head>",
+			"b.css":          "body { color: blue; }\n",
+			"c.html":         `<link rel="stylesheet" href="lib.css">`,
+			"lib.css":        "body { color: green; }\n",
+		})
+		b := NewBuilder([]string{source}, destination, release).ScriptsPrefix("js/").StylesPrefix("css/")
+		if !assert.NoError(t, b.Build()) {
+			continue
+		}
+		a, err := ioutil.ReadFile(filepath.Join(destination, "a.html"))
+		if !assert.NoError(t, err) {
+			continue
+		}
+		if release {
+			assert.Regexp(t, `<link rel="stylesheet" href="/css/a\.[0-9a-f]{8}\.css">\n`+
+				`<link rel="stylesheet" href="/js/a\.[0-9a-f]{8}\.css">`, string(a))
+		} else {
+			assert.Contains(t, string(a), `<link rel="stylesheet" href="/css/a.css">`+"\n"+
+				`<link rel="stylesheet" href="/js/a.css">`)
+			if content, err := ioutil.ReadFile(filepath.Join(destination, "css", "a.css")); assert.NoError(t, err) {
+				assert.Contains(t, string(content), "padding")
+			}
+		}
+		if content, err := ioutil.ReadFile(filepath.Join(destination, "b.html")); assert.NoError(t, err) {
+			assert.Contains(t, string(content), `<link rel="stylesheet" href="/css/b.`)
+		}
+		// stylesheets of no page are copied, imported ones are bundled only
+		if content, err := ioutil.ReadFile(filepath.Join(destination, "c.html")); assert.NoError(t, err) {
+			assert.Equal(t, `<link rel="stylesheet" href="`+b.assetOutputs["/lib.css"].File+`">`, string(content))
+			assert.FileExists(t, filepath.Join(destination, b.assetOutputs["/lib.css"].File))
+		}
+		assert.Len(t, b.assetOutputs, 1)
+		if !release {
+			base := filepath.Join(source, "lib", "base.css")
+			builds, ok := b.affectedBuilds([]string{base})
+			assert.True(t, ok)
+			assert.Equal(t, []string{filepath.Join(source, "a.css")}, builds)
+		}
+	}
+}
+
+func TestCopyAssets(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{
+		"a.html":            "<!--#APP#-->",
+		"a.js":              "console.log('a');\n",
+		"img/logo.png":      "png",
+		"favicon.ico":       "ico",
+		"fonts/font.woff2":  "woff2",
+		".gitignore":        "dist/",
+		".eslintrc":         "{}",
+		"package.json":      "{}",
+		"theme.scss":        "$color: red;",
+		"docs/README.md":    "# docs",
+		".well-known/a.txt": "a",
+		".htaccess":         "deny",
+	})
+	b := NewBuilder([]string{source}, destination, true).
+		Verbatim([]string{".ico", "fonts/", ".well-known/", ".htaccess"}).
+		Assets([]string{".well-known/", ".htaccess"})
+	if !assert.NoError(t, b.Build()) {
+		return
+	}
+	outputs := make(map[string]string)
+	for name, entry := range b.assetOutputs {
+		outputs[name] = entry.File
+		assert.FileExists(t, filepath.Join(destination, entry.File))
+	}
+	assert.Equal(t, map[string]string{
+		"/img/logo.png":      "/img/logo.bff139fa.png",
+		"/favicon.ico":       "/favicon.ico",
+		"/fonts/font.woff2":  "/fonts/font.woff2",
+		"/.well-known/a.txt": "/.well-known/a.txt",
+		"/.htaccess":         "/.htaccess",
+	}, outputs)
+	// private files are not copied
+	for _, name := range []string{".gitignore", ".eslintrc", "package.json", "theme.scss", "docs/README.md"} {
+		assert.NotContains(t, b.assets, filepath.Join(source, name))
+	}
+
+	b = NewBuilder([]string{source}, destination, false)
+	if !assert.NoError(t, b.Build()) {
+		return
+	}
+	assert.FileExists(t, filepath.Join(destination, "img", "logo.png"))
+	logo := filepath.Join(source, "img", "logo.png")
+	writeFiles(t, source, map[string]string{"img/logo.png": "new png"})
+	if assert.NoError(t, b.BuildChanged(context.Background(), []string{logo})) {
+		assert.Equal(t, []string{"/img/logo.png"}, b.ChangedOutputs())
+		content, _ := ioutil.ReadFile(filepath.Join(destination, "img", "logo.png"))
+		assert.Equal(t, "new png", string(content))
+	}
+}
+
+func TestManifest(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{
+		"app/app.html":     "<!--#STYLES#--><!--#APP#-->",
+		"app/app.js":       "import './imported.css';\nconsole.log('app');\n",
+		"app/app.css":      "body { color: red; }\n",
+		"app/imported.css": "p { margin: 0; }\n",
+		"img/logo.png":     "png",
+	})
+	b := NewBuilder([]string{source}, destination, true).ScriptsPrefix("js/").StylesPrefix("css/")
+	if !assert.NoError(t, b.Build()) {
+		return
+	}
+	content, err := ioutil.ReadFile(filepath.Join(destination, "manifest.json"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var manifest map[string]manifestEntry
+	if !assert.NoError(t, json.Unmarshal(content, &manifest)) {
+		return
+	}
+	assert.Len(t, manifest, 3)
+	app := manifest["app/app.js"]
+	assert.Regexp(t, `^/js/app/app\.[0-9a-f]{8}\.js$`, app.File)
+	assert.Equal(t, "/js/app/app.js.map", app.Sourcemap)
+	if assert.NotNil(t, app.CSS) {
+		assert.Regexp(t, `^/js/app/app\.[0-9a-f]{8}\.css$`, app.CSS.File)
+	}
+	assert.Regexp(t, `^/css/app/app\.[0-9a-f]{8}\.css$`, manifest["app/app.css"].File)
+	logo := manifest["img/logo.png"]
+	assert.Equal(t, manifestEntry{File: "/img/logo.bff139fa.png", Hash: "bff139fa", Size: 3}, logo)
+	for _, entry := range []manifestEntry{app, *app.CSS, manifest["app/app.css"], logo} {
+		if info, err := os.Stat(filepath.Join(destination, entry.File)); assert.NoError(t, err) {
+			assert.Equal(t, int64(entry.Size), info.Size())
+			assert.Contains(t, entry.File, entry.Hash)
+		}
+	}
+}
+
+func TestRewriteReferences(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{
+		"pages/a.html": `<link rel="stylesheet" href="../styles/b.css"><img src="/img/logo.png" srcset="../img/logo.png 2x">` +
+			`<a href="b.html">b</a><a href="/">home</a><a href="/account/login">login</a><!--#APP#-->` +
+			`<link rel="alternate" href="/de/pricing"><link rel="canonical" href="/"><iframe src="/widgets/map"></iframe>`,
+		"pages/a.js":    "console.log('a');\n",
+		"pages/b.html":  `<script src="a.js"></script>`,
+		"styles/b.css":  "body { color: red; }\n",
+		"styles/b.html": `<!--#STYLES#-->`,
+		"img/logo.png":  "png",
+	})
+	b := NewBuilder([]string{source}, destination, true)
+	if !assert.NoError(t, b.Build()) {
+		return
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(destination, "pages", "a.html")); assert.NoError(t, err) {
+		assert.Regexp(t, `^<link rel="stylesheet" href="/styles/b\.[0-9a-f]{8}\.css">`+
+			`<img src="/img/logo\.bff139fa\.png" srcset="/img/logo\.bff139fa\.png 2x">`+
+			`<a href="b\.html">b</a><a href="/">home</a><a href="/account/login">login</a><script src="/pages/a\.[0-9a-f]{8}\.js"></script>`+
+			`<link rel="alternate" href="/de/pricing"><link rel="canonical" href="/"><iframe src="/widgets/map"></iframe>$`, string(content))
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(destination, "pages", "b.html")); assert.NoError(t, err) {
+		assert.Regexp(t, `^<script src="/pages/a\.[0-9a-f]{8}\.js"></script>$`, string(content))
+	}
+	writeFiles(t, source, map[string]string{"pages/b.html": `<img src="missing.png">`})
+	assert.Error(t, NewBuilder([]string{source}, t.TempDir(), true).Build())
+	assert.NoError(t, NewBuilder([]string{source}, t.TempDir(), false).Build())
+
+	// the stylesheet paired with a page having a script is not bundled with equal prefixes
+	writeFiles(t, source, map[string]string{"pages/b.html": `<link rel="stylesheet" href="a.css">`, "pages/a.css": "p { margin: 0; }\n"})
+	err := NewBuilder([]string{source}, t.TempDir(), true).Build()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `"a.css" is not bundled since /pages/a.html has a script`)
+	}
+}
+
+func TestJSXBuild(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{
+		"tsconfig.json":                "{}\n",
+		"node_modules/react/index.js":  "export function createElement() {}\nexport const Fragment = 'fragment';\n",
+		"node_modules/preact/index.js": "export function h() {}\nexport const Fragment = 'fragment';\n",
+		"a.html":                       "<!--#APP#-->",
+		"a.jsx":                        "import {h, Fragment} from 'preact';\nconsole.log(<><b>a</b></>);\n",
+		"b.html":                       "<!--#APP#-->",
+		"b.tsx":                        "const name: string = 'b';\nconsole.log(<b>{name}</b>);\n",
+		"c.html":                       "<!--#APP#-->",
+		"c.mjs":                        "export const c = 'c module';\nconsole.log(c);\n",
+		"d.html":                       "<!--#APP#-->",
+		"d.cjs":                        "module.exports = 'd commonjs';\n",
+		"d.js":                         "console.log('d script');\n",
+	})
+	b := NewBuilder([]string{source}, destination, false).
+		TypeScriptConfig(filepath.Join(source, "tsconfig.json")).
+		JSX("h", "Fragment")
+	if !assert.NoError(t, b.Build()) {
+		return
+	}
+	assert.Len(t, b.jsApps, 4)
+	outputs := map[string]string{
+		"a.js": "h(Fragment, null, /* @__PURE__ */ h(\"b\"",
+		"c.js": "c module",
+		"d.js": "d script",
+	}
+	for name, expect := range outputs {
+		if content, err := ioutil.ReadFile(filepath.Join(destination, name)); assert.NoError(t, err) {
+			assert.Contains(t, string(content), expect)
+		}
+		if content, err := ioutil.ReadFile(filepath.Join(destination, strings.TrimSuffix(name, ".js")+".html")); assert.NoError(t, err) {
+			assert.Equal(t, `<script src="/`+name+`"></script>`, string(content))
+		}
+	}
+	// b.tsx uses no explicit factory import, it compiles with the automatic runtime only
+	writeFiles(t, source, map[string]string{
+		"a.jsx":  "console.log(<><b>a</b><i key=\"k\">i</i></>);\n",
+		"e.html": "<!--#APP#-->",
+		"e.tsx":  "const e: Array<number> = [1];\nconsole.log(e);\n",
+		"f.html": "<!--#APP#-->",
+		"f.tsx":  "const f: number = 1;\nconsole.log(f);\n",
+		"node_modules/emotion/jsx-runtime.js": "export function jsx(type, props, key) { return ['jsx', type, props, key]; }\n" +
+			"export function jsxs(type, props, key) { return ['jsxs', type, props, key]; }\nexport const Fragment = 'emotion fragment';\n",
+	})
+	b = NewBuilder([]string{source}, destination, false).
+		TypeScriptConfig(filepath.Join(source, "tsconfig.json")).
+		JSXAutomaticRuntime("emotion")
+	if !assert.NoError(t, b.Build()) {
+		return
+	}
+	for _, name := range []string{"a.js", "b.js"} {
+		if content, err := ioutil.ReadFile(filepath.Join(destination, name)); assert.NoError(t, err) {
+			assert.Contains(t, string(content), "function jsx(type, props, key)")
+			assert.Contains(t, string(content), "__jsx(\"b\"")
+			assert.NotContains(t, string(content), "createElement")
+		}
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(destination, "a.js")); assert.NoError(t, err) {
+		assert.Contains(t, string(content), "emotion fragment")
+	}
+	// files without JSX import no runtime
+	if content, err := ioutil.ReadFile(filepath.Join(destination, "f.js")); assert.NoError(t, err) {
+		assert.NotContains(t, string(content), "jsx-runtime")
+	}
+}
+
+func TestLoaders(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{
+		"app/app.html":    `<!--#STYLES#--><!--#APP#--><img src="icon.svg">`,
+		"app/app.js":      "import logo from '../vendor/logo.svg';\nimport icon from './icon.svg';\nimport note from './note.txt';\nimport data from './data.bin';\nconsole.log(logo, icon, note, data);\n",
+		"app/icon.svg":    "<svg>icon</svg>",
+		"app/app.css":     "body { background: url(../vendor/logo.svg); }\n",
+		"app/note.txt":    "plain note",
+		"app/data.bin":    "binary",
+		"vendor/logo.svg": "<svg></svg>",
+	})
+	matcher, err := ignore.New([]string{source}, []string{"vendor/"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	b := NewBuilder([]string{source}, destination, true).
+		Ignore(matcher).
+		ScriptsPrefix("js/").
+		StylesPrefix("css/").
+		Loaders(map[string]string{"svg": "file", ".txt": "text", "bin": "base64"})
+	if !assert.NoError(t, b.Build()) {
+		return
+	}
+	svgs, err := filepath.Glob(filepath.Join(destination, "js", "app", "logo.*.svg"))
+	if !assert.NoError(t, err) || !assert.Len(t, svgs, 1) {
+		return
+	}
+	logo := "/js/app/" + filepath.Base(svgs[0])
+	scripts, _ := filepath.Glob(filepath.Join(destination, "js", "app", "app.*.js"))
+	if assert.Len(t, scripts, 1) {
+		content, _ := ioutil.ReadFile(scripts[0])
+		assert.Contains(t, string(content), `"`+logo+`"`)
+		assert.Contains(t, string(content), `"plain note"`)
+		assert.Contains(t, string(content), `"YmluYXJ5"`)
+	}
+	styles, _ := filepath.Glob(filepath.Join(destination, "css", "app", "app.*.css"))
+	if assert.Len(t, styles, 1) {
+		content, _ := ioutil.ReadFile(styles[0])
+		assert.Contains(t, string(content), "/css/app/logo.")
+	}
+	content, err := ioutil.ReadFile(filepath.Join(destination, "manifest.json"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var manifest map[string]manifestEntry
+	if assert.NoError(t, json.Unmarshal(content, &manifest)) {
+		assert.Equal(t, logo, manifest["vendor/logo.svg"].File)
+		icons, _ := filepath.Glob(filepath.Join(destination, "js", "app", "icon.*.svg"))
+		if assert.Len(t, icons, 1) {
+			icon := "/js/app/" + filepath.Base(icons[0])
+			assert.Equal(t, icon, manifest["app/icon.svg"].File)
+			html, _ := ioutil.ReadFile(filepath.Join(destination, "app", "app.html"))
+			assert.Contains(t, string(html), `<img src="`+icon+`">`)
+		}
+	}
+	// imported files are not copied as assets
+	copies, _ := filepath.Glob(filepath.Join(destination, "app", "*.*.*"))
+	assert.Empty(t, copies)
+
+	err = NewBuilder([]string{source}, t.TempDir(), false).Loaders(map[string]string{"svg": "svgr"}).Build()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `unknown loader "svgr" of ".svg", expected base64, dataurl, file, json, text`)
+	}
+}
+
+func TestImportedAssetChanged(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{
+		"app.html": "<!--#APP#-->",
+		"app.js":   "import msg from './msg.txt';\nconsole.log(msg);\n",
+		"msg.txt":  "first",
+	})
+	b := NewBuilder([]string{source}, destination, false).Loaders(map[string]string{"txt": "text"})
+	if !assert.NoError(t, b.Build()) {
+		return
+	}
+	writeFiles(t, source, map[string]string{"msg.txt": "second"})
+	if assert.NoError(t, b.BuildChanged(context.Background(), []string{filepath.Join(source, "msg.txt")})) {
+		assert.Equal(t, []string{"/app.js"}, b.ChangedOutputs())
+		content, _ := ioutil.ReadFile(filepath.Join(destination, "app.js"))
+		assert.Contains(t, string(content), `"second"`)
+	}
+}
+
+func TestEntries(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{
+		"pages/a.html":       "<!--#APP:header#--><!--#APP#--><!--#APP:checkout#-->",
+		"pages/a.js":         "console.log('a');\n",
+		"pages/b.html":       `<!--#APP:header#--><script src="../shared/unused.js"></script>`,
+		"shared/header.js":   "console.log('header');\n",
+		"shop/checkout.html": "<!--#APP#-->",
+		"shop/checkout.js":   "console.log('checkout');\n",
+		"shared/unused.js":   "console.log('unused');\n",
+	})
+	entries := map[string]string{
+		"header":   filepath.Join(source, "shared", "header.js"),
+		"checkout": filepath.Join(source, "shop", "checkout.js"),
+		"unused":   filepath.Join(source, "shared", "unused.js"),
+	}
+	b := NewBuilder([]string{source}, destination, true).ScriptsPrefix("js/").Entries(entries)
+	if !assert.NoError(t, b.Build()) {
+		return
+	}
+	assert.Len(t, b.buildOptions, 4)
+	assert.ElementsMatch(t, []string{"/pages/a.html", "/shop/checkout.html"}, b.bundles["/shop/checkout.html"])
+	script := `<script src="/js/%s\.[0-9a-f]{8}\.js"></script>`
+	if content, err := ioutil.ReadFile(filepath.Join(destination, "pages", "a.html")); assert.NoError(t, err) {
+		assert.Regexp(t, "^"+fmt.Sprintf(script, "shared/header")+fmt.Sprintf(script, "pages/a")+
+			fmt.Sprintf(script, "shop/checkout")+"$", string(content))
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(destination, "pages", "b.html")); assert.NoError(t, err) {
+		// entries are resolved by references as well
+		assert.Regexp(t, "^"+fmt.Sprintf(script, "shared/header")+fmt.Sprintf(script, "shared/unused")+"$", string(content))
+	}
+	content, err := ioutil.ReadFile(filepath.Join(destination, "manifest.json"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var manifest map[string]manifestEntry
+	if assert.NoError(t, json.Unmarshal(content, &manifest)) {
+		assert.Len(t, manifest, 4)
+		assert.Regexp(t, `^/js/shared/unused\.[0-9a-f]{8}\.js$`, manifest["shared/unused.js"].File)
+	}
+
+	writeFiles(t, source, map[string]string{"pages/b.html": "<!--#APP:footer#-->"})
+	err = NewBuilder([]string{source}, t.TempDir(), false).Entries(entries).Build()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `unknown entry "footer"`)
+	}
+}
+
+func TestPageSources(t *testing.T) {
+	root, destination := t.TempDir(), t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"templates/shop/cart.html": `<!--#APP src="../../scripts/cart.js"#--><!--#APP src='/lib/menu.js'#-->`,
+		"templates/index.html":     `<!--#APP src="/lib/menu.js"#-->`,
+		"scripts/cart.js":          "console.log('cart');\n",
+		"scripts/lib/menu.js":      "console.log('menu');\n",
+	})
+	templates, scripts := filepath.Join(root, "templates"), filepath.Join(root, "scripts")
+	b := NewBuilder([]string{templates, scripts}, destination, false).ScriptsPrefix("js/")
+	if !assert.NoError(t, b.Build()) {
+		return
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(destination, "shop", "cart.html")); assert.NoError(t, err) {
+		assert.Equal(t, `<script src="/js/cart.js"></script><script src="/js/lib/menu.js"></script>`, string(content))
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(destination, "index.html")); assert.NoError(t, err) {
+		assert.Equal(t, `<script src="/js/lib/menu.js"></script>`, string(content))
+	}
+	menu := filepath.Join(scripts, "lib", "menu.js")
+	builds, ok := b.affectedBuilds([]string{menu})
+	if assert.True(t, ok) && assert.Len(t, builds, 1) {
+		assert.Equal(t, []string{"/index.html", "/shop/cart.html"}, b.bundles[builds[0]])
+	}
+
+	index := filepath.Join(templates, "index.html")
+	writeFiles(t, root, map[string]string{"templates/index.html": `<!--#APP src="../scripts/cart.js"#-->`})
+	if assert.NoError(t, b.BuildChanged(context.Background(), []string{index})) {
+		content, _ := ioutil.ReadFile(filepath.Join(destination, "index.html"))
+		assert.Equal(t, `<script src="/js/cart.js"></script>`, string(content))
+	}
+
+	writeFiles(t, root, map[string]string{"templates/index.html": `<!--#APP src="missing.js"#-->`})
+	assert.Error(t, NewBuilder([]string{templates, scripts}, t.TempDir(), false).Build())
+
+	// the src script is paired with the cart page as well
+	writeFiles(t, root, map[string]string{
+		"templates/index.html": `<!--#APP src="../scripts/cart.js"#-->`,
+		"templates/cart.html":  `<!--#APP#-->`,
+	})
+	destination = t.TempDir()
+	if !assert.NoError(t, NewBuilder([]string{templates, scripts}, destination, true).ScriptsPrefix("js/").Build()) {
+		return
+	}
+	cart, _ := ioutil.ReadFile(filepath.Join(destination, "cart.html"))
+	assert.Regexp(t, `^<script src="/js/cart\.[0-9a-f]{8}\.js"></script>$`, string(cart))
+	if content, err := ioutil.ReadFile(filepath.Join(destination, "index.html")); assert.NoError(t, err) {
+		assert.Equal(t, string(cart), string(content))
+	}
+}
+
+func TestPartials(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{
+		"a.html":               "<!--#INCLUDE partials/header.html#-->a",
+		"b/b.html":             "<!--#INCLUDE /partials/header.html#-->b<!--#INCLUDE footer.inc#-->",
+		"b/footer.inc":         "<footer></footer>",
+		"c.html":               "c",
+		"partials/header.html": "<header><!--#INCLUDE nav.html#--></header>",
+		"partials/nav.html":    "<nav>first</nav>",
+		"partials/unused.html": "unused",
+	})
+	b := NewBuilder([]string{source}, destination, false)
+	if !assert.NoError(t, b.Build()) {
+		return
+	}
+	assert.Equal(t, []string{"/a.html", "/b/b.html", "/c.html", "/partials/unused.html"}, b.pageNames())
+	assert.Empty(t, b.assets)
+	assert.NoFileExists(t, filepath.Join(destination, "partials", "header.html"))
+	assert.NoFileExists(t, filepath.Join(destination, "b", "footer.inc"))
+	if content, err := ioutil.ReadFile(filepath.Join(destination, "b", "b.html")); assert.NoError(t, err) {
+		assert.Equal(t, "<header><nav>first</nav></header>b<footer></footer>", string(content))
+	}
+	nav := filepath.Join(source, "partials", "nav.html")
+	writeFiles(t, source, map[string]string{"partials/nav.html": "<nav>second</nav>"})
+	if assert.NoError(t, b.BuildChanged(context.Background(), []string{nav})) {
+		assert.Equal(t, []string{"/a.html", "/b/b.html"}, b.ChangedOutputs())
+		content, _ := ioutil.ReadFile(filepath.Join(destination, "a.html"))
+		assert.Equal(t, "<header><nav>second</nav></header>a", string(content))
+	}
+	writeFiles(t, source, map[string]string{"partials/nav.html": "<!--#INCLUDE header.html#-->"})
+	assert.Error(t, b.BuildChanged(context.Background(), []string{nav}))
+}
+
+func TestLayouts(t *testing.T) {
+	root, destination := t.TempDir(), t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"layouts/base.html": `<title>[[block "title" .]]Site[[end]]</title><!--#STYLES#-->[[block "body" .]][[end]]<!--#APP#-->`,
+		"pages/a.html":      `<!--#LAYOUT /base.html#-->[[define "title"]]A[[end]][[define "body"]]<img src="logo.png">[[end]]`,
+		"pages/a.js":        "console.log('a');\n",
+		"pages/a.css":       "body { color: red; }\n",
+		"pages/logo.png":    "png",
+		"pages/b.html":      `<!--#LAYOUT ../layouts/base.html#-->[[define "body"]]b[[end]]`,
+		"pages/c.html":      `<!--#LAYOUT /base.html#-->[[define "body"]]<a href="{{ .URL }}">Hi {{ .User.Name }}</a>[[end]]`,
+	})
+	sources := []string{filepath.Join(root, "pages"), filepath.Join(root, "layouts")}
+	b := NewBuilder(sources, destination, true).ScriptsPrefix("js/").StylesPrefix("css/")
+	if !assert.NoError(t, b.Build()) {
+		return
+	}
+	assert.Equal(t, []string{"/a.html", "/b.html", "/c.html"}, b.pageNames())
+	assert.NoFileExists(t, filepath.Join(destination, "base.html"))
+	if content, err := ioutil.ReadFile(filepath.Join(destination, "a.html")); assert.NoError(t, err) {
+		assert.Regexp(t, `^<title>A</title><link rel="stylesheet" href="/css/a\.[0-9a-f]{8}\.css">`+
+			`<img src="/logo\.bff139fa\.png"><script src="/js/a\.[0-9a-f]{8}\.js"></script>$`, string(content))
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(destination, "b.html")); assert.NoError(t, err) {
+		assert.Equal(t, `<title>Site</title><!--#STYLES#-->b<!--#APP#-->`, string(content))
+	}
+	// backend template actions pass through layouts
+	if content, err := ioutil.ReadFile(filepath.Join(destination, "c.html")); assert.NoError(t, err) {
+		assert.Equal(t, `<title>Site</title><!--#STYLES#--><a href="{{ .URL }}">Hi {{ .User.Name }}</a><!--#APP#-->`, string(content))
+	}
+
+	b = NewBuilder(sources, destination, false)
+	if !assert.NoError(t, b.Build()) {
+		return
+	}
+	layout := filepath.Join(root, "layouts", "base.html")
+	writeFiles(t, root, map[string]string{"layouts/base.html": `<h1>[[block "title" .]]Site[[end]]</h1>[[block "body" .]][[end]]`})
+	if assert.NoError(t, b.BuildChanged(context.Background(), []string{layout})) {
+		assert.Equal(t, []string{"/a.html", "/b.html", "/c.html"}, b.ChangedOutputs())
+		content, _ := ioutil.ReadFile(filepath.Join(destination, "b.html"))
+		assert.Equal(t, `<h1>Site</h1>b`, string(content))
+	}
+}
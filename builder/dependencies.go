@@ -0,0 +1,261 @@
+package builder
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+type metafile struct {
+	Inputs map[string]struct {
+		Bytes int `json:"bytes"`
+	} `json:"inputs"`
+	Outputs map[string]struct {
+		Inputs map[string]struct {
+			BytesInOutput int `json:"bytesInOutput"`
+		} `json:"inputs"`
+	} `json:"outputs"`
+}
+
+// metafilePath returns a stable temporary path for the esbuild metafile
+// of the build option, so that incremental rebuilds keep writing to it
+func metafilePath(buildOption api.BuildOptions) string {
+	return filepath.Join(
+		os.TempDir(),
+		fmt.Sprintf("front-builder-%d-%x.json", os.Getpid(), md5.Sum([]byte(contextKey(buildOption)))),
+	)
+}
+
+// extractMetafile takes the metafile out of the build result and returns
+// absolute paths of all the build inputs and of the files emitted by
+// the file loader mapped to their sources. esbuild writes the metafile along
+// with the outputs, so it is removed from the disk as well
+func (b *Builder) extractMetafile(build, path string) ([]string, map[string]string, bool) {
+	result := b.buildResult[build]
+	for i, file := range result.OutputFiles {
+		if file.Path != path {
+			continue
+		}
+		_ = os.Remove(path)
+		result.OutputFiles = append(result.OutputFiles[:i:i], result.OutputFiles[i+1:]...)
+		b.buildResult[build] = result
+		inputs, emitted, err := parseMetafile(file.Contents)
+		if err != nil {
+			log.Printf("error reading build metafile: %s", err)
+			return nil, nil, false
+		}
+		return inputs, emitted, true
+	}
+	return nil, nil, false
+}
+
+func parseMetafile(data []byte) ([]string, map[string]string, error) {
+	var meta metafile
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, nil, err
+	}
+	inputs := make([]string, 0, len(meta.Inputs))
+	for input := range meta.Inputs {
+		input, err := filepath.Abs(input)
+		if err != nil {
+			return nil, nil, err
+		}
+		inputs = append(inputs, input)
+	}
+	sort.Strings(inputs)
+	emitted := make(map[string]string)
+	for output, meta := range meta.Outputs {
+		switch filepath.Ext(output) {
+		case ".js", ".css", ".map":
+			continue
+		}
+		if len(meta.Inputs) != 1 {
+			continue
+		}
+		for input := range meta.Inputs {
+			input, err := filepath.Abs(input)
+			if err != nil {
+				return nil, nil, err
+			}
+			if output, err = filepath.Abs(output); err != nil {
+				return nil, nil, err
+			}
+			emitted[output] = input
+		}
+	}
+	return inputs, emitted, nil
+}
+
+// affectedBuilds returns builds which import any of the changed paths. It reports
+// false when the changes can't be resolved through the dependency graph of
+// the last successful build and a full build is required
+func (b *Builder) affectedBuilds(changed []string) ([]string, bool) {
+	if !b.built {
+		return nil, false
+	}
+	affected := make(map[string]struct{})
+	for _, path := range changed {
+		if _, err := os.Stat(path); err != nil {
+			return nil, false
+		}
+		path = filepath.Clean(path)
+		found := false
+		for build, inputs := range b.inputs {
+			if i := sort.SearchStrings(inputs, path); i < len(inputs) && inputs[i] == path {
+				affected[build] = struct{}{}
+				found = true
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	builds := make([]string, 0, len(affected))
+	for build := range affected {
+		builds = append(builds, build)
+	}
+	sort.Strings(builds)
+	return builds, true
+}
+
+// isInput reports whether the path is an input of any build
+func (b *Builder) isInput(path string) bool {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	for _, inputs := range b.inputs {
+		if i := sort.SearchStrings(inputs, path); i < len(inputs) && inputs[i] == path {
+			return true
+		}
+	}
+	return false
+}
+
+// pageOf returns the name of the page built from the changed path
+func (b *Builder) pageOf(path string) (string, bool) {
+	if !strings.HasSuffix(path, b.htmlExtension) {
+		return "", false
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	path = filepath.Clean(path)
+	for name, html := range b.htmls {
+		if html.Source() == path {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// pagesOf returns sorted pages rendered from the changed path, that is
+// the page itself or the pages including the partial
+func (b *Builder) pagesOf(path string) []string {
+	if page, ok := b.pageOf(path); ok {
+		return []string{page}
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	path = filepath.Clean(path)
+	var pages []string
+	for _, page := range b.pageNames() {
+		includes := b.htmls[page].Includes()
+		if i := sort.SearchStrings(includes, path); i < len(includes) && includes[i] == path {
+			pages = append(pages, page)
+		}
+	}
+	return pages
+}
+
+// reparse reads the changed page again and reports whether it still
+// uses the same scripts and partials, otherwise a full build is required
+func (b *Builder) reparse(page string) bool {
+	html := b.htmls[page]
+	entries, sources, includes := html.Entries(), html.Sources(), html.Includes()
+	if err := html.Parse(); err != nil {
+		return false
+	}
+	return equalStrings(entries, html.Entries()) &&
+		equalStrings(sources, html.Sources()) &&
+		equalStrings(includes, html.Includes())
+}
+
+func (b *Builder) appNames() []string {
+	apps := make([]string, 0, len(b.jsApps))
+	for app := range b.jsApps {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+	return apps
+}
+
+func (b *Builder) buildNames() []string {
+	builds := make([]string, 0, len(b.buildOptions))
+	for build := range b.buildOptions {
+		builds = append(builds, build)
+	}
+	sort.Strings(builds)
+	return builds
+}
+
+func (b *Builder) pageNames() []string {
+	pages := make([]string, 0, len(b.htmls))
+	for page := range b.htmls {
+		pages = append(pages, page)
+	}
+	sort.Strings(pages)
+	return pages
+}
+
+func (b *Builder) entryNames() []string {
+	entries := make([]string, 0, len(b.entryApps))
+	for entry := range b.entryApps {
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+	return entries
+}
+
+// entryPages returns sorted pages having placeholders of each entry
+func (b *Builder) entryPages() map[string][]string {
+	pages := make(map[string][]string)
+	for _, page := range b.pageNames() {
+		for _, entry := range b.htmls[page].Entries() {
+			pages[entry] = append(pages[entry], page)
+		}
+		for _, entry := range b.pageSources[page] {
+			pages[entry] = append(pages[entry], page)
+		}
+	}
+	return pages
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,13 @@
+package files
+
+type CSS struct {
+	builtFile
+}
+
+func NewCSS(destination, styleFile string, content []byte) *CSS {
+	return &CSS{builtFile: newBuiltFile(destination, styleFile, content)}
+}
+
+func (c *CSS) GetStyleSource(releaseBuild bool) (string, error) {
+	return c.publicSource(releaseBuild)
+}
@@ -0,0 +1,82 @@
+package files
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// builtFile is a file written by the build, release builds rename it to
+// the name with the content hash
+type builtFile struct {
+	destination string
+	path        string
+	content     []byte
+	source      string
+}
+
+func newBuiltFile(destination, path string, content []byte) builtFile {
+	return builtFile{
+		destination: destination,
+		path:        path,
+		content:     content,
+	}
+}
+
+// publicSource returns the public path of the file, release builds
+// fingerprint the file on the first call
+func (f *builtFile) publicSource(releaseBuild bool) (string, error) {
+	if !releaseBuild {
+		return publicPath(f.destination, f.path), nil
+	}
+	if f.source != "" {
+		// already renamed by the previous render
+		return f.source, nil
+	}
+	source, err := fingerprint(f.destination, f.path, f.content)
+	if err != nil {
+		return "", err
+	}
+	f.source = source
+	return source, nil
+}
+
+// BuiltFile returns path of the file written by the build
+func (f *builtFile) BuiltFile() string {
+	return f.path
+}
+
+// Content returns content of the built file
+func (f *builtFile) Content() []byte {
+	return f.content
+}
+
+// fingerprint renames the built file to a name with the content hash and
+// returns its public path
+func fingerprint(destination, builtFile string, content []byte) (string, error) {
+	source := HashedName(publicPath(destination, builtFile), content)
+	if err := os.Rename(builtFile, filepath.Join(destination, source)); err != nil {
+		return "", err
+	}
+	return source, nil
+}
+
+// HashedName inserts the content hash into the file name before its extension
+func HashedName(name string, content []byte) string {
+	ext := path.Ext(name)
+	return fmt.Sprintf("%s.%s%s", strings.TrimSuffix(name, ext), Hash(content), ext)
+}
+
+// Hash returns the content hash used in the file names
+func Hash(content []byte) string {
+	hash := md5.Sum(content)
+	return hex.EncodeToString(hash[:4])
+}
+
+func publicPath(destination, builtFile string) string {
+	return "/" + strings.TrimPrefix(builtFile, destination)
+}
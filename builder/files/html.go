@@ -2,45 +2,228 @@ package files
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 )
 
 type HTML struct {
-	src    string
-	script *JS
+	src          string
+	script       *JS
+	entries      []string
+	entryJS      map[string]*JS
+	sources      []string
+	sourceJS     map[string]*JS
+	includeRoots []string
+	includes     []string
+	styles       []*CSS
+	liveReload   string
+	resolve      func(ref string) (string, error)
+	output       []byte
 }
 
-var appPlaceholder = []byte(`<!--#APP#-->`)
+var (
+	// entryPlaceholder matches named placeholders of the declared entries
+	entryPlaceholder = regexp.MustCompile(`<!--#APP:([\w.-]+)#-->`)
+	// sourcePlaceholder matches placeholders of the scripts the page declares itself
+	sourcePlaceholder = regexp.MustCompile(`<!--#APP\s+src=["']([^"']+)["']\s*#-->`)
+)
+
+var (
+	appPlaceholder    = []byte(`<!--#APP#-->`)
+	stylesPlaceholder = []byte(`<!--#STYLES#-->`)
+	bodyCloseTag      = []byte(`</body>`)
+)
+
+// liveReloadClient reloads the page when the dev server reports a finished
+// rebuild and swaps stylesheets in place when only they were changed
+const liveReloadClient = `<script>(function(){` +
+	`var s=new EventSource(%s);` +
+	`s.addEventListener("reload",function(){location.reload()});` +
+	`s.addEventListener("css",function(e){var p=e.data.split("\n");` +
+	`document.querySelectorAll('link[rel="stylesheet"]').forEach(function(l){` +
+	`var u=new URL(l.href);if(p.indexOf(u.pathname)>=0){u.searchParams.set("t",Date.now());l.href=u.href}` +
+	`})});` +
+	`})();</script>`
 
 func NewHTML(sourceFile string) *HTML {
 	return &HTML{src: sourceFile}
 }
 
+// Source returns path of the page source file
+func (h *HTML) Source() string {
+	return h.src
+}
+
 func (h *HTML) InjectJS(script *JS) *HTML {
 	h.script = script
 	return h
 }
 
+// Parse reads names of the entries and paths of the scripts
+// the page and its partials have placeholders for
+func (h *HTML) Parse() error {
+	html, includes, err := h.read()
+	if err != nil {
+		return err
+	}
+	h.includes = includes
+	h.entries = placeholderValues(entryPlaceholder, html)
+	h.sources = placeholderValues(sourcePlaceholder, html)
+	return nil
+}
+
+// placeholderValues returns sorted unique values captured by the placeholder
+func placeholderValues(placeholder *regexp.Regexp, html []byte) []string {
+	var values []string
+	seen := make(map[string]struct{})
+	for _, match := range placeholder.FindAllSubmatch(html, -1) {
+		value := string(match[1])
+		if _, ok := seen[value]; !ok {
+			seen[value] = struct{}{}
+			values = append(values, value)
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+// Entries returns sorted names of the entries found by the last Parse
+func (h *HTML) Entries() []string {
+	return h.entries
+}
+
+// Sources returns sorted script paths found by the last Parse as they are
+// written in the placeholders
+func (h *HTML) Sources() []string {
+	return h.sources
+}
+
+// InjectSource sets the script of the placeholder with the src path
+func (h *HTML) InjectSource(src string, script *JS) *HTML {
+	if h.sourceJS == nil {
+		h.sourceJS = make(map[string]*JS)
+	}
+	h.sourceJS[src] = script
+	return h
+}
+
+// InjectEntry sets the script of the named entry placeholder
+func (h *HTML) InjectEntry(name string, script *JS) *HTML {
+	if h.entryJS == nil {
+		h.entryJS = make(map[string]*JS)
+	}
+	h.entryJS[name] = script
+	return h
+}
+
+// InjectCSS sets the stylesheets linked at the styles placeholder
+func (h *HTML) InjectCSS(styles ...*CSS) *HTML {
+	h.styles = styles
+	return h
+}
+
+// ResolveReferences sets the function which maps local references of src,
+// href and srcset attributes to the output paths on render
+func (h *HTML) ResolveReferences(resolve func(ref string) (string, error)) *HTML {
+	h.resolve = resolve
+	return h
+}
+
+// LiveReload makes development renders subscribe to the dev server events
+// endpoint at eventsURL, release renders never contain the client
+func (h *HTML) LiveReload(eventsURL string) *HTML {
+	h.liveReload = eventsURL
+	return h
+}
+
 func (h *HTML) Render(destinationFile string, releaseBuild bool) error {
-	html, err := ioutil.ReadFile(h.src)
+	html, _, err := h.read()
 	if err != nil {
 		return err
 	}
+	if h.resolve != nil {
+		// before injection, so that built files are not resolved again
+		if html, err = rewriteReferences(html, h.resolve); err != nil {
+			return err
+		}
+	}
 	if s := h.script; s != nil {
-		script, err := s.GetScriptSource(releaseBuild)
+		tag, err := s.tag(releaseBuild)
 		if err != nil {
 			return err
 		}
-		html = bytes.ReplaceAll(
-			html,
-			appPlaceholder,
-			[]byte(`<script src="`+script+`"></script>`),
-		)
+		html = bytes.ReplaceAll(html, appPlaceholder, tag)
+	}
+	if html, err = injectScripts(html, entryPlaceholder, h.entryJS, releaseBuild); err != nil {
+		return err
+	}
+	if html, err = injectScripts(html, sourcePlaceholder, h.sourceJS, releaseBuild); err != nil {
+		return err
+	}
+	if len(h.styles) > 0 {
+		tags := make([][]byte, 0, len(h.styles))
+		for _, s := range h.styles {
+			style, err := s.GetStyleSource(releaseBuild)
+			if err != nil {
+				return err
+			}
+			tags = append(tags, []byte(`<link rel="stylesheet" href="`+style+`">`))
+		}
+		html = bytes.ReplaceAll(html, stylesPlaceholder, bytes.Join(tags, []byte("\n")))
+	}
+	if !releaseBuild && h.liveReload != "" {
+		html = injectBeforeBodyEnd(html, []byte(fmt.Sprintf(liveReloadClient, strconv.Quote(h.liveReload))))
 	}
 	if err := os.MkdirAll(filepath.Dir(destinationFile), 0750); err != nil {
 		return err
 	}
+	h.output = html
 	return ioutil.WriteFile(destinationFile, html, 0640)
 }
+
+// Output returns the document written by the last Render
+func (h *HTML) Output() []byte {
+	return h.output
+}
+
+// injectScripts replaces the placeholders with tags of the scripts
+// by the captured placeholder values
+func injectScripts(html []byte, placeholder *regexp.Regexp, scripts map[string]*JS, releaseBuild bool) ([]byte, error) {
+	if len(scripts) == 0 {
+		return html, nil
+	}
+	var err error
+	html = placeholder.ReplaceAllFunc(html, func(match []byte) []byte {
+		s, ok := scripts[string(placeholder.FindSubmatch(match)[1])]
+		if !ok || err != nil {
+			return match
+		}
+		var tag []byte
+		if tag, err = s.tag(releaseBuild); err != nil {
+			return match
+		}
+		return tag
+	})
+	if err != nil {
+		return nil, err
+	}
+	return html, nil
+}
+
+// injectBeforeBodyEnd puts snippet right before the closing body tag or at the
+// end of the document if there is none
+func injectBeforeBodyEnd(html, snippet []byte) []byte {
+	i := bytes.LastIndex(bytes.ToLower(html), bodyCloseTag)
+	if i < 0 {
+		return append(html, snippet...)
+	}
+	result := make([]byte, 0, len(html)+len(snippet))
+	result = append(result, html[:i]...)
+	result = append(result, snippet...)
+	return append(result, html[i:]...)
+}
@@ -50,3 +50,23 @@ func TestHTML(t *testing.T) {
 		log.Fatal(err)
 	}
 }
+
+func TestHTMLLiveReload(t *testing.T) {
+	const root = "./test_files/"
+	testCases := []struct {
+		release bool
+		expect  bool
+	}{
+		{release: false, expect: true},
+		{release: true, expect: false},
+	}
+	for _, tt := range testCases {
+		html := NewHTML(root + "source.html").LiveReload("/__events")
+		if assert.NoError(t, html.Render(root+"out.html", tt.release)) {
+			if r, err := ioutil.ReadFile(root + "out.html"); assert.NoError(t, err) {
+				assert.Equal(t, tt.expect, bytes.Contains(r, []byte(`new EventSource("/__events")`)), string(r))
+				_ = os.Remove(root + "out.html")
+			}
+		}
+	}
+}
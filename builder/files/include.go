@@ -0,0 +1,106 @@
+package files
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// includeDirective matches includes of partials, the path may be quoted
+var includeDirective = regexp.MustCompile(`<!--#INCLUDE\s+["']?([^"'#]+?)["']?\s*#-->`)
+
+// IncludeRoots sets the folders includes are looked up in when they are
+// not found relative to the including file
+func (h *HTML) IncludeRoots(roots []string) *HTML {
+	h.includeRoots = roots
+	return h
+}
+
+// Includes returns sorted paths of the partials and layouts found by the last Parse
+func (h *HTML) Includes() []string {
+	return h.includes
+}
+
+// read returns the page source with all includes expanded and rendered
+// into its layout along with the paths of the included partials and layouts
+func (h *HTML) read() ([]byte, []string, error) {
+	html, includes, err := expandIncludes(h.src, h.includeRoots, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	html, layouts, err := applyLayout(h.src, html, h.includeRoots)
+	if err != nil {
+		return nil, nil, err
+	}
+	includes = append(includes, layouts...)
+	unique := make([]string, 0, len(includes))
+	seen := make(map[string]struct{})
+	for _, include := range includes {
+		if _, ok := seen[include]; !ok {
+			seen[include] = struct{}{}
+			unique = append(unique, include)
+		}
+	}
+	sort.Strings(unique)
+	return html, unique, nil
+}
+
+// expandIncludes replaces include directives of the file with the expanded
+// partials, stack holds the including files to detect include cycles
+func expandIncludes(path string, roots, stack []string) ([]byte, []string, error) {
+	for i, including := range stack {
+		if including == path {
+			return nil, nil, fmt.Errorf("include cycle: %s", strings.Join(append(stack[i:], path), " -> "))
+		}
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	stack = append(stack, path)
+	var includes []string
+	content = includeDirective.ReplaceAllFunc(content, func(directive []byte) []byte {
+		if err != nil {
+			return directive
+		}
+		name := string(includeDirective.FindSubmatch(directive)[1])
+		partial, ok := resolveInclude(path, name, roots)
+		if !ok {
+			err = fmt.Errorf("%s: include %q not found", path, name)
+			return directive
+		}
+		var expanded []byte
+		var nested []string
+		if expanded, nested, err = expandIncludes(partial, roots, stack); err != nil {
+			return directive
+		}
+		includes = append(append(includes, partial), nested...)
+		return expanded
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return content, includes, nil
+}
+
+// resolveInclude looks the partial up relative to the including file and then
+// in the roots, paths starting with a slash are looked up in the roots only
+func resolveInclude(including, name string, roots []string) (string, bool) {
+	var candidates []string
+	if !strings.HasPrefix(name, "/") {
+		candidates = append(candidates, filepath.Join(filepath.Dir(including), filepath.FromSlash(name)))
+	}
+	for _, root := range roots {
+		candidates = append(candidates, filepath.Join(root, filepath.FromSlash(name)))
+	}
+	for _, path := range candidates {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,52 @@
+package files
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIncludes(t *testing.T) {
+	root, partials := t.TempDir(), t.TempDir()
+	for name, content := range map[string]string{
+		filepath.Join(root, "pages", "page.html"):    `<!--#INCLUDE ../layout/header.html#--><main></main><!--#INCLUDE "/footer.html"#-->`,
+		filepath.Join(root, "layout", "header.html"): `<header><!--#INCLUDE nav.html#--></header>`,
+		filepath.Join(root, "layout", "nav.html"):    `<nav><!--#APP:menu#--></nav>`,
+		filepath.Join(partials, "footer.html"):       `<footer></footer>`,
+		filepath.Join(root, "cycle", "a.html"):       `<!--#INCLUDE b.html#-->`,
+		filepath.Join(root, "cycle", "b.html"):       `<!--#INCLUDE a.html#-->`,
+		filepath.Join(root, "missing.html"):          `<!--#INCLUDE nothing.html#-->`,
+	} {
+		if err := os.MkdirAll(filepath.Dir(name), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	html := NewHTML(filepath.Join(root, "pages", "page.html")).IncludeRoots([]string{root, partials})
+	if assert.NoError(t, html.Parse()) {
+		assert.Equal(t, []string{"menu"}, html.Entries())
+		assert.Equal(t, []string{
+			filepath.Join(root, "layout", "header.html"),
+			filepath.Join(root, "layout", "nav.html"),
+			filepath.Join(partials, "footer.html"),
+		}, html.Includes())
+	}
+	out := filepath.Join(t.TempDir(), "page.html")
+	if assert.NoError(t, html.Render(out, false)) {
+		assert.Equal(t, `<header><nav><!--#APP:menu#--></nav></header><main></main><footer></footer>`, string(html.Output()))
+	}
+	err := NewHTML(filepath.Join(root, "cycle", "a.html")).Parse()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "include cycle: ")
+		assert.Contains(t, err.Error(), "a.html -> ")
+	}
+	err = NewHTML(filepath.Join(root, "missing.html")).IncludeRoots([]string{root}).Parse()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `include "nothing.html" not found`)
+	}
+}
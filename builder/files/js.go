@@ -1,42 +1,32 @@
 package files
 
-import (
-	"crypto/md5"
-	"fmt"
-	"os"
-	"path"
-	"path/filepath"
-	"strings"
-)
-
 type JS struct {
-	destination string
-	builtScript string
-	content     []byte
+	builtFile
+	module bool
 }
 
 func NewJS(destination, scriptFile string, content []byte) *JS {
-	return &JS{
-		destination: destination,
-		builtScript: scriptFile,
-		content:     content,
-	}
+	return &JS{builtFile: newBuiltFile(destination, scriptFile, content)}
+}
+
+// Module marks the script as an ES module
+func (j *JS) Module(module bool) *JS {
+	j.module = module
+	return j
 }
 
 func (j *JS) GetScriptSource(releaseBuild bool) (string, error) {
-	filePath := "/" + strings.TrimPrefix(j.builtScript, j.destination)
-	if !releaseBuild {
-		return filePath, nil
+	return j.publicSource(releaseBuild)
+}
+
+// tag returns the script tag of the script
+func (j *JS) tag(releaseBuild bool) ([]byte, error) {
+	source, err := j.GetScriptSource(releaseBuild)
+	if err != nil {
+		return nil, err
 	}
-	ext := path.Ext(filePath)
-	hash := md5.Sum(j.content)
-	source := fmt.Sprintf("%s.%x%s",
-		strings.TrimSuffix(filePath, ext),
-		hash[:4],
-		ext,
-	)
-	if err := os.Rename(j.builtScript, filepath.Join(j.destination, source)); err != nil {
-		return "", err
+	if j.module {
+		return []byte(`<script type="module" src="` + source + `"></script>`), nil
 	}
-	return source, nil
+	return []byte(`<script src="` + source + `"></script>`), nil
 }
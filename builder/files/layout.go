@@ -0,0 +1,75 @@
+package files
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// layoutDirective matches the layout of a page, the path may be quoted
+var layoutDirective = regexp.MustCompile(`<!--#LAYOUT\s+["']?([^"'#]+?)["']?\s*#-->`)
+
+// layoutLeftDelim and layoutRightDelim delimit layout actions, so that
+// the {{ }} actions of backend templates pass through untouched
+const (
+	layoutLeftDelim  = "[["
+	layoutRightDelim = "]]"
+)
+
+// applyLayout renders the page into the layout it names. The page fills
+// the blocks of the layout with [[define]] actions, a layout may name its own
+// layout as well. text/template is used since html/template strips
+// comments and so the placeholders. It returns the rendered document along
+// with the paths of the layouts and their partials
+func applyLayout(path string, content []byte, roots []string) ([]byte, []string, error) {
+	var chain []string
+	var contents [][]byte
+	var includes []string
+	for {
+		directive := layoutDirective.FindSubmatch(content)
+		if directive == nil {
+			break
+		}
+		chain = append(chain, path)
+		contents = append(contents, layoutDirective.ReplaceAll(content, nil))
+		layout, ok := resolveInclude(path, string(directive[1]), roots)
+		if !ok {
+			return nil, nil, fmt.Errorf("%s: layout %q not found", path, directive[1])
+		}
+		for i, extended := range chain {
+			if extended == layout {
+				return nil, nil, fmt.Errorf("layout cycle: %s", strings.Join(append(chain[i:], layout), " -> "))
+			}
+		}
+		var nested []string
+		var err error
+		if content, nested, err = expandIncludes(layout, roots, nil); err != nil {
+			return nil, nil, err
+		}
+		includes = append(append(includes, layout), nested...)
+		path = layout
+	}
+	if len(chain) == 0 {
+		return content, nil, nil
+	}
+	t, err := template.New(path).
+		Delims(layoutLeftDelim, layoutRightDelim).
+		Option("missingkey=error").
+		Parse(string(content))
+	if err != nil {
+		return nil, nil, err
+	}
+	// inner pages are parsed last, so that their definitions win
+	for i := len(chain) - 1; i >= 0; i-- {
+		if _, err := t.New(chain[i]).Parse(string(contents[i])); err != nil {
+			return nil, nil, err
+		}
+	}
+	var html bytes.Buffer
+	if err := t.ExecuteTemplate(&html, path, nil); err != nil {
+		return nil, nil, err
+	}
+	return html.Bytes(), includes, nil
+}
@@ -0,0 +1,56 @@
+package files
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayouts(t *testing.T) {
+	pages, layouts := t.TempDir(), t.TempDir()
+	for name, content := range map[string]string{
+		filepath.Join(pages, "page.html"): `<!--#LAYOUT section.html#-->` +
+			`[[define "title"]]Page[[end]][[define "content"]]page content[[end]]`,
+		filepath.Join(layouts, "section.html"): `<!--#LAYOUT /base.html#-->` +
+			`[[define "body"]]<section>[[block "content" .]]section content[[end]]</section>[[end]]`,
+		filepath.Join(layouts, "base.html"): `<html><head><title>[[block "title" .]]Site[[end]]</title><!--#STYLES#--></head>` +
+			`<body><!--#INCLUDE header.html#-->[[block "body" .]][[end]]<!--#APP#--></body></html>`,
+		filepath.Join(layouts, "header.html"): `<header></header>`,
+		filepath.Join(pages, "cycle.html"):    `<!--#LAYOUT cycle.html#-->`,
+		filepath.Join(pages, "broken.html"):   `<!--#LAYOUT /base.html#-->[[define "title"]][[end`,
+		filepath.Join(pages, "missing.html"):  `<!--#LAYOUT /base.html#-->[[define "title"]][[ .Title ]][[end]]`,
+	} {
+		if err := ioutil.WriteFile(name, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	roots := []string{pages, layouts}
+	html := NewHTML(filepath.Join(pages, "page.html")).IncludeRoots(roots)
+	if assert.NoError(t, html.Parse()) {
+		assert.Equal(t, []string{
+			filepath.Join(layouts, "base.html"),
+			filepath.Join(layouts, "header.html"),
+			filepath.Join(layouts, "section.html"),
+		}, html.Includes())
+	}
+	script := filepath.Join(pages, "page.js")
+	if err := ioutil.WriteFile(script, []byte("console.log('page');\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "page.html")
+	html.InjectJS(NewJS(pages+string(os.PathSeparator), script, nil))
+	if assert.NoError(t, html.Render(out, false)) {
+		assert.Equal(t, `<html><head><title>Page</title><!--#STYLES#--></head>`+
+			`<body><header></header><section>page content</section><script src="/page.js"></script></body></html>`,
+			string(html.Output()))
+	}
+	err := NewHTML(filepath.Join(pages, "cycle.html")).IncludeRoots(roots).Parse()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "layout cycle: ")
+	}
+	assert.Error(t, NewHTML(filepath.Join(pages, "broken.html")).IncludeRoots(roots).Parse())
+	assert.Error(t, NewHTML(filepath.Join(pages, "missing.html")).IncludeRoots(roots).Parse())
+}
@@ -0,0 +1,147 @@
+package files
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// resourceTag matches opening tags of elements which load the referenced
+// files, links like <a href> are left as they are
+var resourceTag = regexp.MustCompile(`(?i)<(img|image|script|link|source|video|audio|track|input)\b(?:[^>"']|"[^"]*"|'[^']*')*>`)
+
+// linkRel matches the rel attribute of a link tag
+var linkRel = regexp.MustCompile(`(?i)\srel\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+
+// fileRels are rel values of link tags which load files, other links
+// like canonical or alternate point to pages
+var fileRels = map[string]bool{
+	"stylesheet":       true,
+	"icon":             true,
+	"apple-touch-icon": true,
+	"preload":          true,
+	"modulepreload":    true,
+	"manifest":         true,
+}
+
+// referenceAttr matches quoted src, href and srcset attributes
+var referenceAttr = regexp.MustCompile(`(?i)(\s(?:src|href|srcset)\s*=\s*)("[^"]*"|'[^']*')`)
+
+// rewriteReferences replaces local references of resource tags with
+// the paths returned by resolve, srcset candidates are resolved one by one
+func rewriteReferences(html []byte, resolve func(ref string) (string, error)) ([]byte, error) {
+	var err error
+	result := resourceTag.ReplaceAllFunc(html, func(tag []byte) []byte {
+		if err != nil || !loadsFile(tag) {
+			return tag
+		}
+		var rewritten []byte
+		if rewritten, err = rewriteAttributes(tag, resolve); err != nil {
+			return tag
+		}
+		return rewritten
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// loadsFile reports whether the resource tag loads a file, link tags
+// do only for some rel values
+func loadsFile(tag []byte) bool {
+	name := resourceTag.FindSubmatch(tag)[1]
+	if !strings.EqualFold(string(name), "link") {
+		return true
+	}
+	rel := linkRel.FindSubmatch(tag)
+	if rel == nil {
+		return false
+	}
+	for _, value := range strings.Fields(strings.ToLower(string(bytes.Join(rel[1:], nil)))) {
+		if fileRels[value] {
+			return true
+		}
+	}
+	return false
+}
+
+func rewriteAttributes(tag []byte, resolve func(ref string) (string, error)) ([]byte, error) {
+	var err error
+	result := referenceAttr.ReplaceAllFunc(tag, func(match []byte) []byte {
+		if err != nil {
+			return match
+		}
+		parts := referenceAttr.FindSubmatch(match)
+		quoted := parts[2]
+		value := string(quoted[1 : len(quoted)-1])
+		var rewritten string
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(string(parts[1]))), "srcset") {
+			rewritten, err = rewriteSrcset(value, resolve)
+		} else {
+			rewritten, err = rewriteReference(value, resolve)
+		}
+		if err != nil {
+			return match
+		}
+		quote := string(quoted[0])
+		return []byte(string(parts[1]) + quote + rewritten + quote)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func rewriteSrcset(srcset string, resolve func(ref string) (string, error)) (string, error) {
+	candidates := strings.Split(srcset, ",")
+	for i, candidate := range candidates {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+		ref, err := rewriteReference(fields[0], resolve)
+		if err != nil {
+			return "", err
+		}
+		fields[0] = ref
+		candidates[i] = strings.Join(fields, " ")
+	}
+	return strings.Join(candidates, ", "), nil
+}
+
+// rewriteReference resolves the path of a local reference keeping
+// its query and fragment
+func rewriteReference(ref string, resolve func(ref string) (string, error)) (string, error) {
+	ref = strings.TrimSpace(ref)
+	if !isLocalReference(ref) {
+		return ref, nil
+	}
+	suffix := ""
+	if i := strings.IndexAny(ref, "?#"); i >= 0 {
+		ref, suffix = ref[:i], ref[i:]
+	}
+	resolved, err := resolve(ref)
+	if err != nil {
+		return "", err
+	}
+	return resolved + suffix, nil
+}
+
+// urlScheme matches the scheme of an absolute URL like https: or data:
+var urlScheme = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:`)
+
+// isLocalReference reports whether ref points to a file of the project,
+// references with template expressions are not local
+func isLocalReference(ref string) bool {
+	switch {
+	case ref == "",
+		strings.HasPrefix(ref, "#"),
+		strings.HasPrefix(ref, "?"),
+		strings.HasPrefix(ref, "//"),
+		urlScheme.MatchString(ref),
+		strings.ContainsAny(ref, "{}<>"):
+		return false
+	}
+	return true
+}
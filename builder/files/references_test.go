@@ -0,0 +1,66 @@
+package files
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteReferences(t *testing.T) {
+	resolve := func(ref string) (string, error) {
+		if ref == "missing.png" {
+			return "", errors.New("unresolved reference")
+		}
+		return "/out/" + ref, nil
+	}
+	testCases := []struct {
+		html   string
+		expect string
+	}{
+		{
+			html:   `<img src="logo.png" alt="logo">`,
+			expect: `<img src="/out/logo.png" alt="logo">`,
+		},
+		{
+			html:   `<link rel="icon" HREF='favicon.ico?v=2'>`,
+			expect: `<link rel="icon" HREF='/out/favicon.ico?v=2'>`,
+		},
+		{
+			html:   `<img srcset="a.png 1x,b.png 2x">`,
+			expect: `<img srcset="/out/a.png 1x, /out/b.png 2x">`,
+		},
+		{
+			html: `<a href="https://example.com/">x</a><a href="#top">x</a><a href="mailto:a@b.c">x</a>` +
+				`<img src="data:image/png;base64,AA=="><a href="{{ .URL }}">x</a><script src="//cdn.js"></script>`,
+			expect: `<a href="https://example.com/">x</a><a href="#top">x</a><a href="mailto:a@b.c">x</a>` +
+				`<img src="data:image/png;base64,AA=="><a href="{{ .URL }}">x</a><script src="//cdn.js"></script>`,
+		},
+		{
+			html:   `<!--#APP src="../scripts/cart.ts"#--><img src="logo.png">`,
+			expect: `<!--#APP src="../scripts/cart.ts"#--><img src="/out/logo.png">`,
+		},
+		{
+			html:   `<a href="/account/login">x</a><map><area href="plan.html"></map><img alt="a > b" src="logo.png">`,
+			expect: `<a href="/account/login">x</a><map><area href="plan.html"></map><img alt="a > b" src="/out/logo.png">`,
+		},
+		{
+			html: `<link rel="alternate" href="/de/pricing"><link rel="canonical" href="/"><iframe src="/widgets/map"></iframe>` +
+				`<link href="font.woff2" rel=preload><link rel="shortcut icon" href="favicon.ico"><link href="nav.css">`,
+			expect: `<link rel="alternate" href="/de/pricing"><link rel="canonical" href="/"><iframe src="/widgets/map"></iframe>` +
+				`<link href="/out/font.woff2" rel=preload><link rel="shortcut icon" href="/out/favicon.ico"><link href="nav.css">`,
+		},
+		{
+			html:   `<p data-src="logo.png">`,
+			expect: `<p data-src="logo.png">`,
+		},
+	}
+	for _, tt := range testCases {
+		result, err := rewriteReferences([]byte(tt.html), resolve)
+		if assert.NoError(t, err) {
+			assert.Equal(t, tt.expect, string(result))
+		}
+	}
+	_, err := rewriteReferences([]byte(`<img src="logo.png"><img src="missing.png">`), resolve)
+	assert.Error(t, err)
+}
@@ -0,0 +1,124 @@
+package builder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+const (
+	defaultJSXImportSource = "react"
+	automaticJSXFactory    = "__jsx"
+	automaticJSXFragment   = "__jsxFragment"
+)
+
+// scriptLoaders are the loaders of the script entry points
+var scriptLoaders = map[string]api.Loader{
+	".js":  api.LoaderJS,
+	".mjs": api.LoaderJS,
+	".cjs": api.LoaderJS,
+	".jsx": api.LoaderJSX,
+	".ts":  api.LoaderTS,
+	".tsx": api.LoaderTSX,
+}
+
+// scriptExtensions lists the extensions of the script entry points,
+// scripts take priority over the ones listed earlier on the same name
+var scriptExtensions = []string{".cjs", ".mjs", ".js", ".jsx", ".ts", ".tsx"}
+
+func scriptPriority(path string) int {
+	ext := filepath.Ext(path)
+	for i, scriptExt := range scriptExtensions {
+		if ext == scriptExt {
+			return i
+		}
+	}
+	return -1
+}
+
+func isTypeScript(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".ts" || ext == ".tsx"
+}
+
+// setJSXOptions applies the JSX settings to the script build
+func (b *Builder) setJSXOptions(buildOption *api.BuildOptions) {
+	if b.jsxImportSource != "" {
+		buildOption.JSXFactory = automaticJSXFactory
+		buildOption.JSXFragment = automaticJSXFragment
+		buildOption.Plugins = []api.Plugin{automaticJSXPlugin(b.jsxImportSource)}
+		return
+	}
+	buildOption.JSXFactory = b.jsxFactory
+	buildOption.JSXFragment = b.jsxFragment
+}
+
+// jsxRuntimeModule is imported by JSX modules in place of the jsx-runtime
+// of the import source, it adapts the runtime to the element factory calls
+// esbuild compiles JSX to
+const jsxRuntimeModule = "front-builder:jsx-runtime"
+
+// jsxSyntax matches the start of a JSX element or fragment
+var jsxSyntax = regexp.MustCompile(`<[A-Za-z>]`)
+
+// automaticJSXPlugin imports the element factory and the fragment adapting
+// <importSource>/jsx-runtime into every JSX module, so that JSX compiles
+// without importing React explicitly. The import is prepended to the first
+// line to keep the line numbers of the source
+func automaticJSXPlugin(importSource string) api.Plugin {
+	imports := fmt.Sprintf("import {%s, %s} from %s;",
+		automaticJSXFactory, automaticJSXFragment, strconv.Quote(jsxRuntimeModule))
+	adapter := fmt.Sprintf(`import {jsx, jsxs, Fragment} from %s;
+export const %[2]s = Fragment;
+export function %[3]s(type, config, ...children) {
+  const props = {};
+  let key;
+  for (const name in config) {
+    if (name === "key") key = config.key;
+    else props[name] = config[name];
+  }
+  if (children.length === 1) props.children = children[0];
+  else if (children.length > 1) props.children = children;
+  return (children.length > 1 ? jsxs : jsx)(type, props, key);
+}
+`, strconv.Quote(importSource+"/jsx-runtime"), automaticJSXFragment, automaticJSXFactory)
+	return api.Plugin{
+		Name: "automatic-jsx",
+		Setup: func(build api.PluginBuild) {
+			build.OnLoad(api.OnLoadOptions{Filter: `\.[jt]sx$`, Namespace: "file"},
+				func(args api.OnLoadArgs) (api.OnLoadResult, error) {
+					source, err := ioutil.ReadFile(args.Path)
+					if err != nil {
+						return api.OnLoadResult{}, err
+					}
+					contents := string(source)
+					if jsxSyntax.Match(source) {
+						contents = imports + contents
+					}
+					return api.OnLoadResult{
+						Contents:   &contents,
+						ResolveDir: filepath.Dir(args.Path),
+						Loader:     scriptLoaders[filepath.Ext(args.Path)],
+					}, nil
+				})
+			// the adapter is resolved per folder, so that the import source
+			// is looked up in node_modules next to the JSX module
+			build.OnResolve(api.OnResolveOptions{Filter: "^" + regexp.QuoteMeta(jsxRuntimeModule) + "$"},
+				func(args api.OnResolveArgs) (api.OnResolveResult, error) {
+					return api.OnResolveResult{Path: args.ResolveDir, Namespace: "jsx-runtime"}, nil
+				})
+			build.OnLoad(api.OnLoadOptions{Filter: ".*", Namespace: "jsx-runtime"},
+				func(args api.OnLoadArgs) (api.OnLoadResult, error) {
+					return api.OnLoadResult{
+						Contents:   &adapter,
+						ResolveDir: args.Path,
+						Loader:     api.LoaderJS,
+					}, nil
+				})
+		},
+	}
+}
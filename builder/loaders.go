@@ -0,0 +1,67 @@
+package builder
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// loaderNames maps names of the loaders which can be assigned to file
+// extensions to esbuild loaders
+var loaderNames = map[string]api.Loader{
+	"file":    api.LoaderFile,
+	"dataurl": api.LoaderDataURL,
+	"text":    api.LoaderText,
+	"base64":  api.LoaderBase64,
+	"json":    api.LoaderJSON,
+}
+
+// LoaderNames returns the sorted names of the loaders which can be
+// assigned to file extensions
+func LoaderNames() []string {
+	names := make([]string, 0, len(loaderNames))
+	for name := range loaderNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckLoaders returns an error if any of the extensions is assigned
+// an unknown loader
+func CheckLoaders(loaders map[string]string) error {
+	for ext, name := range loaders {
+		if _, ok := loaderNames[name]; !ok {
+			return fmt.Errorf("unknown loader %q of %q, expected %s", name, ext, strings.Join(LoaderNames(), ", "))
+		}
+	}
+	return nil
+}
+
+// buildLoaders returns the script loaders along with the configured ones
+func (b *Builder) buildLoaders() (map[string]api.Loader, error) {
+	if err := CheckLoaders(b.loaders); err != nil {
+		return nil, err
+	}
+	loaders := make(map[string]api.Loader, len(scriptLoaders)+len(b.loaders))
+	for ext, loader := range scriptLoaders {
+		loaders[ext] = loader
+	}
+	for ext, name := range b.loaders {
+		loaders[ext] = loaderNames[name]
+	}
+	return loaders, nil
+}
+
+// publicPath returns URL path of the output folder, files emitted by
+// the file loader are referenced by it
+func (b *Builder) publicPath(outdir string) string {
+	rel, err := filepath.Rel(b.destination, outdir)
+	if err != nil || rel == "." {
+		return "/"
+	}
+	return "/" + filepath.ToSlash(rel)
+}
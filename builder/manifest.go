@@ -0,0 +1,150 @@
+package builder
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BrightLocal/FrontBuilder/builder/files"
+)
+
+// manifestFile is written to the destination root after every build
+const manifestFile = "manifest.json"
+
+// manifestEntry describes the output of a source entry or asset,
+// paths are URL paths of the output files
+type manifestEntry struct {
+	File      string         `json:"file"`
+	Hash      string         `json:"hash"`
+	Size      int            `json:"size"`
+	Sourcemap string         `json:"sourcemap,omitempty"`
+	CSS       *manifestEntry `json:"css,omitempty"`
+}
+
+func newManifestEntry(file string, content []byte) manifestEntry {
+	return manifestEntry{
+		File: file,
+		Hash: files.Hash(content),
+		Size: len(content),
+	}
+}
+
+// writeManifest maps source paths of scripts, stylesheets and assets relative
+// to their source folders to the outputs, so that a backend is able to
+// reference the hashed files. Stylesheets imported from a script are listed
+// under the script, files emitted by the file loader are listed as assets
+func (b *Builder) writeManifest() error {
+	manifest := make(map[string]manifestEntry)
+	for name, entry := range b.assetOutputs {
+		manifest[strings.TrimPrefix(filepath.ToSlash(name), "/")] = entry
+	}
+	resultFiles := b.resultFiles()
+	for page, script := range b.jsApps {
+		js, ok := b.pageScripts[page]
+		if !ok {
+			continue
+		}
+		entry, err := b.scriptManifestEntry(js, resultFiles)
+		if err != nil {
+			return err
+		}
+		if css, ok := b.importedStyles[page]; ok {
+			source, err := css.GetStyleSource(b.releaseBuild)
+			if err != nil {
+				return err
+			}
+			cssEntry := newManifestEntry(source, css.Content())
+			entry.CSS = &cssEntry
+		}
+		manifest[strings.TrimPrefix(filepath.ToSlash(script.Path), "/")] = entry
+	}
+	for entry, script := range b.entryApps {
+		js, ok := b.entryScripts[entry]
+		if !ok {
+			// no page uses the entry
+			built := b.scriptOutput(script)
+			content, ok := resultFiles[built]
+			if !ok {
+				continue
+			}
+			js = files.NewJS(b.destination, built, content)
+			b.entryScripts[entry] = js
+		}
+		name := strings.TrimPrefix(filepath.ToSlash(script.Path), "/")
+		if _, ok := manifest[name]; ok {
+			// the script of a page as well
+			continue
+		}
+		entry, err := b.scriptManifestEntry(js, resultFiles)
+		if err != nil {
+			return err
+		}
+		manifest[name] = entry
+	}
+	for page, style := range b.cssApps {
+		css, ok := b.pairedStyles[page]
+		if !ok {
+			continue
+		}
+		source, err := css.GetStyleSource(b.releaseBuild)
+		if err != nil {
+			return err
+		}
+		manifest[strings.TrimPrefix(filepath.ToSlash(style.Path), "/")] = newManifestEntry(source, css.Content())
+	}
+	for _, build := range b.buildNames() {
+		emitted := b.emitted[build]
+		outputs := make([]string, 0, len(emitted))
+		for output := range emitted {
+			outputs = append(outputs, output)
+		}
+		sort.Strings(outputs)
+		for _, output := range outputs {
+			input := emitted[output]
+			name := b.sourceName(input)
+			if _, ok := manifest[name]; ok {
+				// emitted by another build as well
+				continue
+			}
+			if content, ok := resultFiles[output]; ok {
+				manifest[name] = newManifestEntry("/"+filepath.ToSlash(strings.TrimPrefix(output, b.destination)), content)
+			}
+		}
+	}
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(b.destination, manifestFile), content, 0640)
+}
+
+func (b *Builder) scriptManifestEntry(js *files.JS, resultFiles map[string][]byte) (manifestEntry, error) {
+	source, err := js.GetScriptSource(b.releaseBuild)
+	if err != nil {
+		return manifestEntry{}, err
+	}
+	entry := newManifestEntry(source, js.Content())
+	if _, ok := resultFiles[js.BuiltFile()+".map"]; ok {
+		entry.Sourcemap = "/" + filepath.ToSlash(strings.TrimPrefix(js.BuiltFile(), b.destination)) + ".map"
+	}
+	return entry, nil
+}
+
+// sourceName returns slash separated path relative to the source folder
+// of the file, or to the working directory for files out of the sources
+func (b *Builder) sourceName(path string) string {
+	for _, source := range b.sources {
+		if rel, err := filepath.Rel(source, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(path)
+}
@@ -0,0 +1,99 @@
+package builder
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// resolveReference maps a local reference of the page to the URL path of
+// the output file. References starting with a slash are looked up in all
+// the source folders, others relative to the page. Unresolved references
+// fail release builds and are kept as is otherwise
+func (b *Builder) resolveReference(page, ref string) (string, error) {
+	resolved, ok, err := b.findReference(page, ref)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return resolved, nil
+	}
+	err = fmt.Errorf("%s: unresolved reference %q", b.htmls[page].Source(), ref)
+	for _, path := range b.referenceCandidates(page, ref) {
+		if html, ok := b.unbundledStyles[path]; ok {
+			err = fmt.Errorf("%s: %q is not bundled since %s has a script and styles_prefix equals scripts_prefix",
+				b.htmls[page].Source(), ref, html)
+		}
+	}
+	if b.releaseBuild {
+		return "", err
+	}
+	log.Printf("Warning: %s", err)
+	return ref, nil
+}
+
+// referenceCandidates returns the paths the reference may point to
+func (b *Builder) referenceCandidates(page, ref string) []string {
+	name, err := url.PathUnescape(ref)
+	if err != nil {
+		return nil
+	}
+	if !strings.HasPrefix(name, "/") {
+		return []string{filepath.Join(filepath.Dir(b.htmls[page].Source()), filepath.FromSlash(name))}
+	}
+	var candidates []string
+	for _, source := range b.sources {
+		candidates = append(candidates, filepath.Join(source, filepath.FromSlash(name)))
+	}
+	return candidates
+}
+
+func (b *Builder) findReference(page, ref string) (string, bool, error) {
+	candidates := b.referenceCandidates(page, ref)
+	for _, path := range candidates {
+		if asset, ok := b.assets[path]; ok {
+			if entry, ok := b.assetOutputs[asset.Path]; ok {
+				return entry.File, true, nil
+			}
+			if file, ok := b.emittedFile(path); ok {
+				return file, true, nil
+			}
+		}
+		if style, ok := b.styles[path]; ok {
+			html := strings.TrimSuffix(style.Path, ".css") + b.htmlExtension
+			if css, ok := b.pairedStyles[html]; ok {
+				source, err := css.GetStyleSource(b.releaseBuild)
+				return source, err == nil, err
+			}
+		}
+		for html, script := range b.jsApps {
+			if filepath.Join(script.BaseDir, script.Path) != path {
+				continue
+			}
+			if js, ok := b.pageScripts[html]; ok {
+				source, err := js.GetScriptSource(b.releaseBuild)
+				return source, err == nil, err
+			}
+		}
+		for entry, script := range b.entryApps {
+			if filepath.Join(script.BaseDir, script.Path) != path {
+				continue
+			}
+			if js, ok := b.entryScripts[entry]; ok {
+				source, err := js.GetScriptSource(b.releaseBuild)
+				return source, err == nil, err
+			}
+		}
+		if _, ok := b.pageOf(path); ok {
+			// pages keep their paths
+			return ref, true, nil
+		}
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			return ref, true, nil
+		}
+	}
+	return "", false, nil
+}
@@ -8,6 +8,9 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/BrightLocal/FrontBuilder/builder"
 )
 
 type Config struct {
@@ -18,37 +21,82 @@ type Config struct {
 	IndexFile        string
 	HTMLExtension    string
 	ScriptsPrefix    string
+	StylesPrefix     string
 	HTMLPrefix       string
 	TypeScriptConfig string
+	JSXFactory       string
+	JSXFragment      string
+	JSXRuntime       string
+	JSXImportSource  string
+	Serve            bool
+	Host             string
+	Port             int
+	WatchDelay       time.Duration
+	Exclude          []string
+	Gitignore        bool
+	PollInterval     time.Duration
+	Concurrency      int
+	Splitting        bool
+	Verbatim         []string
+	Assets           []string
+	Loaders          map[string]string
+	Entries          map[string]string
 }
 
+// JSX runtimes
+const (
+	JSXClassic   = "classic"
+	JSXAutomatic = "automatic"
+)
+
+const (
+	defaultHost         = "localhost"
+	defaultPort         = 8080
+	defaultPollInterval = time.Second
+)
+
 func Configure() Config {
 	cfg := Config{
 		Env:   "production",
 		Watch: false,
+		Host:  defaultHost,
+		Port:  defaultPort,
+	}
+	args, pollInterval, err := parseFlags(os.Args[1:])
+	if err == errHelp {
+		usage(0)
+	} else if err != nil {
+		fmt.Println(err)
+		usage(1)
 	}
-	if len(os.Args) == 2 {
-		if os.Args[1] == "watch" {
+	if len(args) == 1 {
+		switch args[0] {
+		case "watch":
+			cfg.Env = "development"
+			cfg.Watch = true
+		case "serve":
 			cfg.Env = "development"
 			cfg.Watch = true
+			cfg.Serve = true
 		}
-	} else if len(os.Args) == 3 {
-		if os.Args[1] != "build" {
-			fmt.Println("Expected command: 'build' or 'watch'")
-			usage()
-			os.Exit(1)
+	} else if len(args) == 2 {
+		if args[0] != "build" {
+			fmt.Println("Expected command: 'build', 'watch' or 'serve'")
+			usage(1)
 		}
-		if e := os.Args[2]; e != "" {
+		if e := args[1]; e != "" {
 			cfg.Env = e
 		}
 	} else {
-		usage()
+		usage(1)
 	}
 	if err := cfg.readConfigFile(); err != nil {
 		fmt.Printf("Error reading config file: %s\n", err)
 		os.Exit(1)
 	}
-	var err error
+	if pollInterval > 0 {
+		cfg.PollInterval = pollInterval
+	}
 	if cfg.Destination, err = filepath.Abs(cfg.Destination); err != nil {
 		fmt.Printf("Error expanind destination path: %s\n", err)
 		os.Exit(1)
@@ -69,6 +117,12 @@ func Configure() Config {
 			os.Exit(1)
 		}
 	}
+	for name, entry := range cfg.Entries {
+		if cfg.Entries[name], err = filepath.Abs(entry); err != nil {
+			fmt.Printf("Error expanding entry %q path: %s\n", name, err)
+			os.Exit(1)
+		}
+	}
 	return cfg
 }
 
@@ -83,13 +137,30 @@ func (c *Config) readConfigFile() error {
 	}
 	defer func() { _ = f.Close() }()
 	type fConfig struct {
-		Source           interface{} `json:"source"`
-		Destination      string      `json:"destination"`
-		IndexFile        string      `json:"index_file"`
-		HTMLExtension    string      `json:"html_extension"`
-		ScriptsPrefix    string      `json:"scripts_prefix"`
-		HTMLPrefix       string      `json:"html_prefix"`
-		TypeScriptConfig string      `json:"type_script_config"`
+		Source           interface{}       `json:"source"`
+		Destination      string            `json:"destination"`
+		IndexFile        string            `json:"index_file"`
+		HTMLExtension    string            `json:"html_extension"`
+		ScriptsPrefix    string            `json:"scripts_prefix"`
+		StylesPrefix     string            `json:"styles_prefix"`
+		HTMLPrefix       string            `json:"html_prefix"`
+		TypeScriptConfig string            `json:"type_script_config"`
+		JSXFactory       string            `json:"jsx_factory"`
+		JSXFragment      string            `json:"jsx_fragment"`
+		JSXRuntime       string            `json:"jsx_runtime"`
+		JSXImportSource  string            `json:"jsx_import_source"`
+		ServeHost        string            `json:"serve_host"`
+		ServePort        int               `json:"serve_port"`
+		WatchDelay       int               `json:"watch_delay"`
+		Exclude          []string          `json:"exclude"`
+		Gitignore        bool              `json:"gitignore"`
+		PollInterval     int               `json:"poll_interval"`
+		Concurrency      int               `json:"concurrency"`
+		Splitting        bool              `json:"splitting"`
+		Verbatim         []string          `json:"verbatim"`
+		Assets           []string          `json:"assets"`
+		Loaders          map[string]string `json:"loaders"`
+		Entries          map[string]string `json:"entries"`
 	}
 	var fc fConfig
 	if err = json.NewDecoder(f).Decode(&fc); err != nil {
@@ -112,17 +183,96 @@ func (c *Config) readConfigFile() error {
 	c.IndexFile = fc.IndexFile
 	c.HTMLExtension = fc.HTMLExtension
 	c.ScriptsPrefix = fc.ScriptsPrefix
+	c.StylesPrefix = fc.StylesPrefix
 	c.HTMLPrefix = fc.HTMLPrefix
 	c.TypeScriptConfig = fc.TypeScriptConfig
+	switch fc.JSXRuntime {
+	case "", JSXClassic:
+	case JSXAutomatic:
+		if fc.JSXFactory != "" || fc.JSXFragment != "" {
+			return errors.New("jsx_factory and jsx_fragment can not be used with automatic jsx_runtime")
+		}
+	default:
+		return errors.New("jsx_runtime can be either classic or automatic")
+	}
+	c.JSXFactory = fc.JSXFactory
+	c.JSXFragment = fc.JSXFragment
+	c.JSXRuntime = fc.JSXRuntime
+	c.JSXImportSource = fc.JSXImportSource
+	if fc.ServeHost != "" {
+		c.Host = fc.ServeHost
+	}
+	if fc.ServePort < 0 || fc.ServePort > 65535 {
+		return errors.New("serve_port must be between 1 and 65535")
+	} else if fc.ServePort != 0 {
+		c.Port = fc.ServePort
+	}
+	if fc.WatchDelay < 0 {
+		return errors.New("watch_delay can not be negative")
+	}
+	c.WatchDelay = time.Duration(fc.WatchDelay) * time.Millisecond
+	c.Exclude = fc.Exclude
+	c.Gitignore = fc.Gitignore
+	if fc.PollInterval < 0 {
+		return errors.New("poll_interval can not be negative")
+	}
+	c.PollInterval = time.Duration(fc.PollInterval) * time.Millisecond
+	if fc.Concurrency < 0 {
+		return errors.New("concurrency can not be negative")
+	}
+	c.Concurrency = fc.Concurrency
+	c.Splitting = fc.Splitting
+	c.Verbatim = fc.Verbatim
+	c.Assets = fc.Assets
+	if err := builder.CheckLoaders(fc.Loaders); err != nil {
+		return err
+	}
+	c.Loaders = fc.Loaders
+	c.Entries = fc.Entries
 	return nil
 }
 
-func usage() {
+// errHelp is returned by parseFlags when the usage is asked for explicitly
+var errHelp = errors.New("help requested")
+
+// parseFlags separates flags from positional arguments
+func parseFlags(args []string) ([]string, time.Duration, error) {
+	var positional []string
+	var pollInterval time.Duration
+	for _, arg := range args {
+		switch {
+		case arg == "--help", arg == "-h", arg == "help":
+			return nil, 0, errHelp
+		case arg == "--poll":
+			pollInterval = defaultPollInterval
+		case strings.HasPrefix(arg, "--poll="):
+			interval, err := time.ParseDuration(strings.TrimPrefix(arg, "--poll="))
+			if err != nil || interval <= 0 {
+				return nil, 0, fmt.Errorf("invalid poll interval %q", arg)
+			}
+			pollInterval = interval
+		case strings.HasPrefix(arg, "--"):
+			return nil, 0, fmt.Errorf("unknown flag %q", arg)
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	return positional, pollInterval, nil
+}
+
+// usage prints the usage and exits with the code, 0 is for explicit help only
+func usage(code int) {
 	fmt.Printf(`Usage:
 %[1]s build prod -- builds production version
 %[1]s build      -- same as 'build prod'
 %[1]s build dev  -- builds development version
 %[1]s watch      -- build dev version and continue watching for files change
+%[1]s serve      -- same as 'watch' and serve destination directory over HTTP
+
+Flags:
+--poll           -- watch for files change by polling every second instead of file system events
+--poll=500ms     -- same as --poll with the given interval
+--help           -- print this usage
 `, path.Base(os.Args[0]))
-	os.Exit(0)
+	os.Exit(code)
 }
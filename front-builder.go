@@ -1,21 +1,45 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/BrightLocal/FrontBuilder/builder"
 	"github.com/BrightLocal/FrontBuilder/config"
+	"github.com/BrightLocal/FrontBuilder/ignore"
+	"github.com/BrightLocal/FrontBuilder/server"
 	"github.com/BrightLocal/FrontBuilder/watcher"
 )
 
+const shutdownTimeout = 5 * time.Second
+
 func main() {
 	start := time.Now()
 	fmt.Println("Start build process")
 	cfg := config.Configure()
+	matcher, err := ignore.New(cfg.Source, cfg.Exclude)
+	if err != nil {
+		fmt.Printf("Error in exclude patterns: %s\n", err)
+		os.Exit(1)
+	}
+	if cfg.Gitignore {
+		if err = matcher.LoadGitignore("."); err == nil {
+			err = matcher.LoadGitignoreTree(cfg.Source...)
+		}
+		if err != nil {
+			fmt.Printf("Error reading .gitignore: %s\n", err)
+			os.Exit(1)
+		}
+	}
 	frontBuilder := builder.NewBuilder(cfg.Source, cfg.Destination, cfg.IsProduction())
+	frontBuilder.Ignore(matcher)
 	if cfg.HTMLExtension != "" {
 		frontBuilder.HTMLExtension(cfg.HTMLExtension)
 	}
@@ -23,33 +47,102 @@ func main() {
 		frontBuilder.IndexFile(cfg.IndexFile)
 	}
 	frontBuilder.ScriptsPrefix(cfg.ScriptsPrefix)
+	frontBuilder.StylesPrefix(cfg.StylesPrefix)
 	frontBuilder.HTMLPrefix(cfg.HTMLPrefix)
 	frontBuilder.TypeScriptConfig(cfg.TypeScriptConfig)
+	if cfg.JSXRuntime == config.JSXAutomatic {
+		frontBuilder.JSXAutomaticRuntime(cfg.JSXImportSource)
+	} else {
+		frontBuilder.JSX(cfg.JSXFactory, cfg.JSXFragment)
+	}
+	frontBuilder.Incremental(cfg.Watch)
+	frontBuilder.Concurrency(cfg.Concurrency)
+	frontBuilder.Splitting(cfg.Splitting)
+	frontBuilder.Verbatim(cfg.Verbatim)
+	frontBuilder.Assets(cfg.Assets)
+	frontBuilder.Loaders(cfg.Loaders)
+	frontBuilder.Entries(cfg.Entries)
+	if cfg.Serve {
+		frontBuilder.LiveReload(server.EventsPath)
+	}
 	if err := frontBuilder.Build(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 	fmt.Printf("Build finished: %s\n", time.Since(start))
 	if cfg.Watch {
-		buildWatcher, err := watcher.NewBuildWatcher(cfg.Source)
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+		var devServer *server.DevServer
+		if cfg.Serve {
+			devServer = server.NewDevServer(cfg.Destination, cfg.Host, cfg.Port)
+			if cfg.IndexFile != "" {
+				devServer.IndexFile(cfg.IndexFile)
+			}
+			go func() {
+				log.Printf("Serving %s on http://%s/", cfg.Destination, devServer.Addr())
+				if err := devServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					log.Fatalf("error serving files: %s", err)
+				}
+			}()
 		}
+		buildWatcher := watcher.NewBuildWatcher(cfg.Source)
 		done := make(chan struct{})
-		events, err := buildWatcher.Watch()
+		if cfg.PollInterval > 0 {
+			log.Printf("Polling source directories every %s", cfg.PollInterval)
+		}
+		events, err := buildWatcher.
+			Delay(cfg.WatchDelay).
+			Ignore(matcher).
+			Poll(cfg.PollInterval).
+			Watch()
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
-		go func(e chan struct{}) {
-			for range e {
-				log.Println("Rebuild project files")
-				if err = frontBuilder.Build(); err != nil {
-					log.Printf("error rebuilding files: %s", err)
-				}
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		scheduler := watcher.NewScheduler(func(ctx context.Context, changes []watcher.Event) error {
+			log.Printf("Rebuild project files, changes: %v", changes)
+			changed := make([]string, 0, len(changes))
+			rescan := false
+			for _, change := range changes {
+				changed = append(changed, change.Path)
+				rescan = rescan || change.Op&watcher.Rescan != 0
 			}
-		}(events)
+			var err error
+			if rescan {
+				err = frontBuilder.BuildContext(ctx)
+			} else {
+				err = frontBuilder.BuildChanged(ctx, changed)
+			}
+			switch {
+			case errors.Is(err, context.Canceled):
+				log.Println("Rebuild cancelled by newer changes")
+			case err != nil:
+				log.Printf("error rebuilding files: %s", err)
+			case devServer != nil:
+				devServer.Notify(frontBuilder.ChangedOutputs())
+			}
+			return err
+		})
+		go func() {
+			defer close(done)
+			scheduler.Run(events)
+		}()
+		sig := <-signals
+		// a second signal terminates the process immediately
+		signal.Stop(signals)
+		log.Printf("Received %s, shutting down", sig)
+		if err := buildWatcher.Close(); err != nil {
+			log.Printf("error closing watcher: %s", err)
+		}
+		if devServer != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			if err := devServer.Shutdown(ctx); err != nil {
+				log.Printf("error shutting down server: %s", err)
+			}
+			cancel()
+		}
+		// let the rebuild in progress finish
 		<-done
 	}
 }
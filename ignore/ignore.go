@@ -0,0 +1,280 @@
+package ignore
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultPatterns are always excluded: VCS and dependency folders and
+// temporary files of editors
+var DefaultPatterns = []string{
+	".git/",
+	".svn/",
+	".hg/",
+	"node_modules/",
+	".idea/",
+	"*~",
+	".*.swp",
+	".*.swx",
+	".#*",
+	"#*#",
+	".DS_Store",
+}
+
+// Matcher decides which files are excluded from builds and watching.
+// Patterns follow .gitignore rules: a pattern without a slash matches the name
+// at any depth, a pattern with a slash is anchored to its base directory,
+// a trailing slash matches directories only and a leading "!" re-includes
+// files excluded by previous patterns
+type Matcher struct {
+	rules []rule
+}
+
+type rule struct {
+	base     string
+	re       *regexp.Regexp
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// defaultRules are DefaultPatterns compiled once, without a base directory
+var defaultRules = mustParseRules(DefaultPatterns)
+
+// Default returns the matcher of DefaultPatterns relative to each of roots
+func Default(roots []string) *Matcher {
+	m := &Matcher{}
+	for _, root := range roots {
+		base, err := filepath.Abs(root)
+		if err != nil {
+			base = filepath.Clean(root)
+		}
+		for _, r := range defaultRules {
+			r.base = base
+			m.rules = append(m.rules, r)
+		}
+	}
+	return m
+}
+
+// New returns the matcher of DefaultPatterns and patterns relative to each of roots
+func New(roots []string, patterns []string) (*Matcher, error) {
+	m := &Matcher{}
+	for _, root := range roots {
+		for _, pattern := range append(DefaultPatterns[:len(DefaultPatterns):len(DefaultPatterns)], patterns...) {
+			if err := m.add(root, pattern); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return m, nil
+}
+
+// LoadGitignore adds patterns of .gitignore files found in dirs, missing
+// files are skipped
+func (m *Matcher) LoadGitignore(dirs ...string) error {
+	for _, dir := range dirs {
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		if err = m.loadGitignore(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadGitignoreTree adds patterns of .gitignore files found in roots and in
+// their subfolders, patterns of a nested file are relative to its folder.
+// Folders excluded by the patterns loaded so far are not searched
+func (m *Matcher) LoadGitignoreTree(roots ...string) error {
+	for _, root := range roots {
+		root, err := filepath.Abs(root)
+		if err != nil {
+			return err
+		}
+		defaults := Default([]string{root})
+		err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && path == root {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if !info.IsDir() {
+				return nil
+			}
+			if path != root && (defaults.match(path, true) || m.Match(path, true)) {
+				return filepath.SkipDir
+			}
+			return m.loadGitignore(path)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadGitignore adds patterns of the .gitignore file of dir, a missing
+// file is skipped
+func (m *Matcher) loadGitignore(dir string) error {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if err = m.add(dir, scanner.Text()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Match reports whether the path or any of its parent directories is excluded
+func (m *Matcher) Match(filePath string, isDir bool) bool {
+	if m == nil || len(m.rules) == 0 {
+		return false
+	}
+	filePath, err := filepath.Abs(filePath)
+	if err != nil {
+		return false
+	}
+	for dir := filepath.Dir(filePath); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if m.match(dir, true) {
+			return true
+		}
+	}
+	return m.match(filePath, isDir)
+}
+
+func (m *Matcher) match(filePath string, isDir bool) bool {
+	ignored := false
+	for _, r := range m.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		rel, err := filepath.Rel(r.base, filePath)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		if !r.anchored {
+			rel = path.Base(rel)
+		}
+		if r.re.MatchString(rel) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+func (m *Matcher) add(base, pattern string) error {
+	r, ok, err := parseRule(pattern)
+	if err != nil || !ok {
+		return err
+	}
+	if r.base, err = filepath.Abs(base); err != nil {
+		return err
+	}
+	m.rules = append(m.rules, r)
+	return nil
+}
+
+// parseRule compiles a pattern, ok is false for blank lines and comments
+func parseRule(pattern string) (r rule, ok bool, err error) {
+	pattern = strings.TrimRight(pattern, " \t\r")
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return r, false, nil
+	}
+	if strings.HasPrefix(pattern, "!") {
+		r.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\`) {
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		r.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if strings.Contains(pattern, "/") {
+		r.anchored = true
+		pattern = strings.TrimPrefix(pattern, "/")
+	}
+	if pattern == "" {
+		return r, false, nil
+	}
+	if r.re, err = regexp.Compile(globToRegexp(pattern)); err != nil {
+		return r, false, err
+	}
+	return r, true, nil
+}
+
+func mustParseRules(patterns []string) []rule {
+	var rules []rule
+	for _, pattern := range patterns {
+		r, ok, err := parseRule(pattern)
+		if err != nil {
+			panic(err)
+		}
+		if ok {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// globToRegexp converts a glob with "**" support into an anchored regular expression
+func globToRegexp(glob string) string {
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					// "**/" matches zero or more directories
+					i++
+					re.WriteString("(?:.*/)?")
+				} else {
+					re.WriteString(".*")
+				}
+			} else {
+				re.WriteString("[^/]*")
+			}
+		case '?':
+			re.WriteString("[^/]")
+		case '[':
+			if end := strings.IndexByte(glob[i+1:], ']'); end > 0 {
+				class := glob[i+1 : i+1+end]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				re.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+				i += end + 1
+			} else {
+				re.WriteString(`\[`)
+			}
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				re.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	return re.String()
+}
@@ -0,0 +1,101 @@
+package ignore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	root := t.TempDir()
+	if !assert.NoError(t, ioutil.WriteFile(filepath.Join(root, ".gitignore"), []byte("# build output\n/dist/\n*.log\n!keep.log\n"), 0640)) {
+		return
+	}
+	m, err := New([]string{root}, []string{"vendor/**/*.min.js", "tmp/", "drafts"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.NoError(t, m.LoadGitignore(root, filepath.Join(root, "missing"))) {
+		return
+	}
+	testCases := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{path: "app.ts"},
+		{path: "node_modules", isDir: true, ignored: true},
+		{path: "node_modules/react/index.js", ignored: true},
+		{path: "app/.git/HEAD", ignored: true},
+		{path: "app/.app.ts.swp", ignored: true},
+		{path: "app/app.ts~", ignored: true},
+		{path: "vendor/lib/jquery.min.js", ignored: true},
+		{path: "vendor/jquery.min.js", ignored: true},
+		{path: "vendor/jquery.js"},
+		{path: "tmp", isDir: true, ignored: true},
+		{path: "tmp"},
+		{path: "pages/drafts/index.html", ignored: true},
+		{path: "dist/app.js", ignored: true},
+		{path: "app/dist/app.js"},
+		{path: "debug.log", ignored: true},
+		{path: "keep.log"},
+	}
+	for _, tt := range testCases {
+		assert.Equal(t, tt.ignored, m.Match(filepath.Join(root, tt.path), tt.isDir), tt.path)
+	}
+	assert.False(t, m.Match(root, true))
+	assert.False(t, m.Match("/elsewhere/app.log", false))
+}
+
+func TestLoadGitignoreTree(t *testing.T) {
+	root := t.TempDir()
+	gitignores := map[string]string{
+		".gitignore":                     "*.log\n",
+		"app/.gitignore":                 "/generated/\n!keep.log\n",
+		"app/widgets/.gitignore":         "*.tmp\n",
+		"other/widgets/generated/a.html": "",
+	}
+	for name, content := range gitignores {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if !assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0750)) {
+			return
+		}
+		if !assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0640)) {
+			return
+		}
+	}
+	m := Default([]string{root})
+	if !assert.NoError(t, m.LoadGitignoreTree(root, filepath.Join(root, "missing"))) {
+		return
+	}
+	testCases := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{path: "debug.log", ignored: true},
+		{path: "app/debug.log", ignored: true},
+		{path: "app/keep.log"},
+		{path: "keep.log", ignored: true},
+		{path: "app/generated", isDir: true, ignored: true},
+		{path: "app/generated/a.html", ignored: true},
+		{path: "other/widgets/generated/a.html"},
+		{path: "app/widgets/a.tmp", ignored: true},
+		{path: "other/a.tmp"},
+	}
+	for _, tt := range testCases {
+		assert.Equal(t, tt.ignored, m.Match(filepath.Join(root, filepath.FromSlash(tt.path)), tt.isDir), tt.path)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	root := t.TempDir()
+	m := Default([]string{root})
+	assert.True(t, m.Match(filepath.Join(root, "node_modules/react/index.js"), false))
+	assert.True(t, m.Match(filepath.Join(root, "app/.app.ts.swp"), false))
+	assert.False(t, m.Match(filepath.Join(root, "app.ts"), false))
+	assert.False(t, m.Match(filepath.Join(t.TempDir(), "node_modules/react/index.js"), false))
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// EventsPath is the Server-Sent Events endpoint the live reload client
+// injected into dev pages subscribes to
+const EventsPath = "/__front-builder/events"
+
+type message struct {
+	event string
+	data  string
+}
+
+type reloader struct {
+	mu        sync.Mutex
+	clients   map[chan message]struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newReloader() *reloader {
+	return &reloader{
+		clients: make(map[chan message]struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+func (rl *reloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	c := make(chan message, 1)
+	rl.subscribe(c)
+	defer rl.unsubscribe(c)
+	_, _ = fmt.Fprint(w, "retry: 1000\n\n")
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-rl.done:
+			return
+		case m := <-c:
+			writeMessage(w, m)
+			flusher.Flush()
+		}
+	}
+}
+
+func writeMessage(w io.Writer, m message) {
+	_, _ = fmt.Fprintf(w, "event: %s\n", m.event)
+	if m.data != "" {
+		for _, line := range strings.Split(m.data, "\n") {
+			_, _ = fmt.Fprintf(w, "data: %s\n", line)
+		}
+	}
+	_, _ = fmt.Fprint(w, "\n")
+}
+
+// close disconnects all clients, otherwise their streams would never let
+// the server shut down
+func (rl *reloader) close() {
+	rl.closeOnce.Do(func() { close(rl.done) })
+}
+
+func (rl *reloader) subscribe(c chan message) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.clients[c] = struct{}{}
+}
+
+func (rl *reloader) unsubscribe(c chan message) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	delete(rl.clients, c)
+}
+
+func (rl *reloader) broadcast(m message) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	for c := range rl.clients {
+		select {
+		case c <- m:
+		default:
+			// client has not consumed previous message yet, it will reload anyway
+		}
+	}
+}
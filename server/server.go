@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type DevServer struct {
+	root      string
+	indexFile string
+	server    *http.Server
+	reloader  *reloader
+}
+
+const defaultIndexFile = "index.html"
+
+// mimeTypes covers extensions which are commonly missing from system MIME
+// databases, mime.TypeByExtension is used for the rest
+var mimeTypes = map[string]string{
+	".html":  "text/html; charset=utf-8",
+	".htm":   "text/html; charset=utf-8",
+	".js":    "application/javascript; charset=utf-8",
+	".mjs":   "application/javascript; charset=utf-8",
+	".css":   "text/css; charset=utf-8",
+	".json":  "application/json; charset=utf-8",
+	".map":   "application/json; charset=utf-8",
+	".svg":   "image/svg+xml",
+	".ico":   "image/x-icon",
+	".webp":  "image/webp",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+	".ttf":   "font/ttf",
+	".otf":   "font/otf",
+	".wasm":  "application/wasm",
+	".txt":   "text/plain; charset=utf-8",
+}
+
+func NewDevServer(root, host string, port int) *DevServer {
+	s := &DevServer{
+		root:      root,
+		indexFile: defaultIndexFile,
+		reloader:  newReloader(),
+	}
+	s.server = &http.Server{
+		Addr:    net.JoinHostPort(host, strconv.Itoa(port)),
+		Handler: s,
+	}
+	return s
+}
+
+func (s *DevServer) IndexFile(fileName string) *DevServer {
+	s.indexFile = filepath.Base(fileName)
+	return s
+}
+
+func (s *DevServer) Addr() string {
+	return s.server.Addr
+}
+
+// ListenAndServe serves the files until Shutdown is called, in which case
+// http.ErrServerClosed is returned
+func (s *DevServer) ListenAndServe() error {
+	return s.server.ListenAndServe()
+}
+
+// Shutdown disconnects live reload clients and gracefully shuts down the server
+func (s *DevServer) Shutdown(ctx context.Context) error {
+	s.reloader.close()
+	return s.server.Shutdown(ctx)
+}
+
+// Reload tells all connected browser tabs to reload the page
+func (s *DevServer) Reload() {
+	s.reloader.broadcast(message{event: "reload"})
+}
+
+// Notify tells connected browser tabs about changed output files: when only
+// stylesheets were changed they are swapped in place, otherwise the page is reloaded
+func (s *DevServer) Notify(changed []string) {
+	if len(changed) == 0 {
+		return
+	}
+	for _, path := range changed {
+		if !strings.HasSuffix(path, ".css") {
+			s.Reload()
+			return
+		}
+	}
+	s.reloader.broadcast(message{event: "css", data: strings.Join(changed, "\n")})
+}
+
+func (s *DevServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == EventsPath {
+		s.reloader.ServeHTTP(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	name := filepath.Join(s.root, filepath.FromSlash(path.Clean("/"+r.URL.Path)))
+	info, err := os.Stat(name)
+	if err == nil && info.IsDir() {
+		name = filepath.Join(name, s.indexFile)
+		info, err = os.Stat(name)
+	}
+	if err != nil {
+		if os.IsNotExist(err) || os.IsPermission(err) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = f.Close() }()
+	if contentType := contentType(name); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+func contentType(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if t, ok := mimeTypes[ext]; ok {
+		return t
+	}
+	return mime.TypeByExtension(ext)
+}
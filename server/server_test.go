@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDevServer(t *testing.T) {
+	root := t.TempDir()
+	if !assert.NoError(t, os.MkdirAll(filepath.Join(root, "js"), 0750)) {
+		return
+	}
+	for name, content := range map[string]string{
+		"index.htm":     "<h1>index</h1>",
+		"js/app.js":     "console.log('app');",
+		"js/app.js.map": "{}",
+		"styles.css":    "body{}",
+	} {
+		if !assert.NoError(t, ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0640)) {
+			return
+		}
+	}
+	s := NewDevServer(root, "localhost", 8080).IndexFile("index.htm")
+	testCases := []struct {
+		method      string
+		path        string
+		status      int
+		contentType string
+		body        string
+	}{
+		{method: http.MethodGet, path: "/", status: http.StatusOK, contentType: "text/html; charset=utf-8", body: "<h1>index</h1>"},
+		{method: http.MethodGet, path: "/js/app.js", status: http.StatusOK, contentType: "application/javascript; charset=utf-8", body: "console.log('app');"},
+		{method: http.MethodGet, path: "/js/app.js.map", status: http.StatusOK, contentType: "application/json; charset=utf-8", body: "{}"},
+		{method: http.MethodGet, path: "/styles.css", status: http.StatusOK, contentType: "text/css; charset=utf-8", body: "body{}"},
+		{method: http.MethodGet, path: "/js/", status: http.StatusNotFound},
+		{method: http.MethodGet, path: "/../../etc/passwd", status: http.StatusNotFound},
+		{method: http.MethodPost, path: "/", status: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusOK {
+				assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+				assert.Equal(t, tt.body, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestDevServerReload(t *testing.T) {
+	s := NewDevServer(t.TempDir(), "localhost", 8080)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + EventsPath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	r := bufio.NewReader(resp.Body)
+	if line, err := r.ReadString('\n'); assert.NoError(t, err) {
+		assert.Equal(t, "retry: 1000\n", line)
+	}
+	_, _ = r.ReadString('\n')
+	s.Reload()
+	if line, err := r.ReadString('\n'); assert.NoError(t, err) {
+		assert.Equal(t, "event: reload\n", line)
+	}
+}
+
+func TestDevServerNotify(t *testing.T) {
+	testCases := []struct {
+		changed []string
+		expect  []string
+	}{
+		{changed: nil, expect: nil},
+		{changed: []string{"/app.css", "/styles/main.css"}, expect: []string{"event: css\n", "data: /app.css\n", "data: /styles/main.css\n"}},
+		{changed: []string{"/app.css", "/app.js"}, expect: []string{"event: reload\n"}},
+	}
+	for _, tt := range testCases {
+		s := NewDevServer(t.TempDir(), "localhost", 8080)
+		c := make(chan message, 1)
+		s.reloader.subscribe(c)
+		s.Notify(tt.changed)
+		select {
+		case m := <-c:
+			w := httptest.NewRecorder()
+			writeMessage(w, m)
+			assert.Equal(t, strings.Join(tt.expect, "")+"\n", w.Body.String())
+		default:
+			assert.Nil(t, tt.expect)
+		}
+	}
+}
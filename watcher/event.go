@@ -0,0 +1,80 @@
+package watcher
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Op describes a set of file operations
+type Op uint8
+
+const (
+	Create Op = 1 << iota
+	Write
+	Remove
+	Rename
+	// Rescan means events under Root were lost and all of it has to be rebuilt
+	Rescan
+)
+
+// Event is a change of a single path inside one of the watched source roots.
+// Op may combine several operations when a burst of events touched the path
+type Event struct {
+	Path string
+	Op   Op
+	Root string
+}
+
+func (op Op) String() string {
+	var ops []string
+	for _, o := range []struct {
+		op   Op
+		name string
+	}{
+		{Create, "CREATE"},
+		{Write, "WRITE"},
+		{Remove, "REMOVE"},
+		{Rename, "RENAME"},
+		{Rescan, "RESCAN"},
+	} {
+		if op&o.op != 0 {
+			ops = append(ops, o.name)
+		}
+	}
+	return strings.Join(ops, "|")
+}
+
+func (e Event) String() string {
+	return e.Op.String() + " " + e.Path
+}
+
+func fromFSNotify(op fsnotify.Op) Op {
+	var result Op
+	if op&fsnotify.Create != 0 {
+		result |= Create
+	}
+	if op&fsnotify.Write != 0 {
+		result |= Write
+	}
+	if op&fsnotify.Remove != 0 {
+		result |= Remove
+	}
+	if op&fsnotify.Rename != 0 {
+		result |= Rename
+	}
+	return result
+}
+
+// rootOf returns the watched source root path belongs to
+func (bw *BuildWatcher) rootOf(path string) string {
+	var root string
+	for _, p := range bw.paths {
+		if (path == p || strings.HasPrefix(path, strings.TrimRight(p, string(filepath.Separator))+string(filepath.Separator))) &&
+			len(p) > len(root) {
+			root = p
+		}
+	}
+	return root
+}
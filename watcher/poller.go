@@ -0,0 +1,97 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+	isDir   bool
+}
+
+// Poll makes the watcher check the source trees every interval instead of
+// relying on file system events, which never arrive for some bind-mounted
+// volumes and network file systems
+func (bw *BuildWatcher) Poll(interval time.Duration) *BuildWatcher {
+	bw.pollInterval = interval
+	return bw
+}
+
+func (bw *BuildWatcher) poll(changes chan<- Event, snapshot map[string]fileState) {
+	ticker := time.NewTicker(bw.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-bw.done:
+			return
+		case <-ticker.C:
+			current, err := bw.scan()
+			if err != nil {
+				bw.onError(err)
+				continue
+			}
+			for _, event := range bw.diff(snapshot, current) {
+				if !bw.send(changes, event) {
+					return
+				}
+			}
+			snapshot = current
+		}
+	}
+}
+
+// scan records modification time and size of every path under the source roots
+func (bw *BuildWatcher) scan() (map[string]fileState, error) {
+	snapshot := make(map[string]fileState)
+	for _, root := range bw.paths {
+		if err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && path != root {
+					// removed while walking
+					return nil
+				}
+				return err
+			}
+			if path != root && bw.ignore.Match(path, info.IsDir()) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			snapshot[path] = fileState{
+				modTime: info.ModTime(),
+				size:    info.Size(),
+				isDir:   info.IsDir(),
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return snapshot, nil
+}
+
+// diff turns the difference of two snapshots into events sorted by path
+func (bw *BuildWatcher) diff(previous, current map[string]fileState) []Event {
+	var events []Event
+	for path, state := range current {
+		prev, ok := previous[path]
+		switch {
+		case !ok:
+			events = append(events, Event{Path: path, Op: Create, Root: bw.rootOf(path)})
+		case !state.isDir && (prev.isDir || !prev.modTime.Equal(state.modTime) || prev.size != state.size):
+			events = append(events, Event{Path: path, Op: Write, Root: bw.rootOf(path)})
+		}
+	}
+	for path := range previous {
+		if _, ok := current[path]; !ok {
+			events = append(events, Event{Path: path, Op: Remove, Root: bw.rootOf(path)})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Path < events[j].Path })
+	return events
+}
@@ -0,0 +1,101 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// BuildFunc builds the project for the changes. It is expected to stop early
+// and return the context error once ctx is cancelled
+type BuildFunc func(ctx context.Context, changes []Event) error
+
+// Scheduler runs one build at a time. Changes reported while a build is in
+// progress are collapsed into a single follow-up build, and the build in
+// progress is cancelled when the new changes make its result outdated
+type Scheduler struct {
+	build BuildFunc
+}
+
+func NewScheduler(build BuildFunc) *Scheduler {
+	return &Scheduler{build: build}
+}
+
+// Run consumes events until the channel is closed and the build in progress
+// finishes, pending changes are dropped at that point
+func (s *Scheduler) Run(events <-chan []Event) {
+	var (
+		pending  []Event
+		building []Event
+		cancel   context.CancelFunc
+		finished = make(chan error)
+	)
+	start := func() {
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		building, pending = pending, nil
+		go func(changes []Event) {
+			finished <- s.build(ctx, changes)
+		}(building)
+	}
+	for events != nil || building != nil {
+		select {
+		case changes, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			pending = mergeEvents(pending, changes)
+			if building == nil {
+				start()
+			} else if outdates(building, changes) {
+				cancel()
+			}
+		case err := <-finished:
+			cancel()
+			if errors.Is(err, context.Canceled) {
+				pending = mergeEvents(building, pending)
+			}
+			building = nil
+			if events != nil && len(pending) > 0 {
+				start()
+			}
+		}
+	}
+}
+
+// outdates reports whether changes make the result of the build outdated
+func outdates(building, changes []Event) bool {
+	paths := make(map[string]struct{}, len(building))
+	for _, event := range building {
+		paths[event.Path] = struct{}{}
+	}
+	for _, event := range changes {
+		if event.Op&Rescan != 0 {
+			return true
+		}
+		if _, ok := paths[event.Path]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeEvents combines operations of events on the same path, the result is sorted by path
+func mergeEvents(a, b []Event) []Event {
+	merged := make(map[string]Event, len(a)+len(b))
+	for _, events := range [][]Event{a, b} {
+		for _, event := range events {
+			if prev, ok := merged[event.Path]; ok {
+				event.Op |= prev.Op
+			}
+			merged[event.Path] = event
+		}
+	}
+	result := make([]Event, 0, len(merged))
+	for _, event := range merged {
+		result = append(result, event)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result
+}
@@ -0,0 +1,83 @@
+package watcher
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedulerCollapsesPendingChanges(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls [][]Event
+	)
+	started, release, followUp := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	s := NewScheduler(func(ctx context.Context, changes []Event) error {
+		mu.Lock()
+		calls = append(calls, changes)
+		first := len(calls) == 1
+		mu.Unlock()
+		if first {
+			close(started)
+			<-release
+		} else {
+			close(followUp)
+		}
+		return nil
+	})
+	events := make(chan []Event)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(events)
+	}()
+	events <- []Event{{Path: "/src/a.js", Op: Write}}
+	<-started
+	events <- []Event{{Path: "/src/b.js", Op: Write}}
+	events <- []Event{{Path: "/src/c.js", Op: Create}}
+	events <- []Event{{Path: "/src/b.js", Op: Remove}}
+	close(release)
+	<-followUp
+	close(events)
+	<-done
+	assert.Equal(t, [][]Event{
+		{{Path: "/src/a.js", Op: Write}},
+		{{Path: "/src/b.js", Op: Write | Remove}, {Path: "/src/c.js", Op: Create}},
+	}, calls)
+}
+
+func TestSchedulerCancelsOutdatedBuild(t *testing.T) {
+	var calls [][]Event
+	var results []error
+	started := make(chan struct{}, 1)
+	s := NewScheduler(func(ctx context.Context, changes []Event) error {
+		calls = append(calls, changes)
+		started <- struct{}{}
+		if len(calls) == 1 {
+			<-ctx.Done()
+			results = append(results, ctx.Err())
+			return ctx.Err()
+		}
+		results = append(results, nil)
+		return nil
+	})
+	events := make(chan []Event)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(events)
+	}()
+	events <- []Event{{Path: "/src/a.js", Op: Write}, {Path: "/src/b.js", Op: Write}}
+	<-started
+	events <- []Event{{Path: "/src/a.js", Op: Write}}
+	<-started
+	close(events)
+	<-done
+	assert.Equal(t, [][]Event{
+		{{Path: "/src/a.js", Op: Write}, {Path: "/src/b.js", Op: Write}},
+		{{Path: "/src/a.js", Op: Write}, {Path: "/src/b.js", Op: Write}},
+	}, calls)
+	assert.Equal(t, []error{context.Canceled, nil}, results)
+}
@@ -1,53 +1,220 @@
 package watcher
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
-	"strings"
+	"sort"
+	"sync"
+	"time"
 
+	"github.com/BrightLocal/FrontBuilder/ignore"
 	"github.com/fsnotify/fsnotify"
 )
 
 type BuildWatcher struct {
+	// Watcher is created by Watch unless the source trees are polled
 	Watcher *fsnotify.Watcher
 	paths   []string
+	delay   time.Duration
+	onError func(error)
+	ignore  *ignore.Matcher
+	// pollInterval enables polling of the source trees instead of fsnotify
+	pollInterval time.Duration
+	done         chan struct{}
+	closeOnce    sync.Once
 }
 
-func NewBuildWatcher(paths []string) (*BuildWatcher, error) {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		return nil, err
-	}
+// defaultDelay is the quiet period after the last file system event before
+// the collected changes are reported
+const defaultDelay = 100 * time.Millisecond
+
+func NewBuildWatcher(paths []string) *BuildWatcher {
 	return &BuildWatcher{
-		Watcher: watcher,
 		paths:   paths,
-	}, nil
+		ignore:  ignore.Default(paths),
+		delay:   defaultDelay,
+		onError: func(err error) { log.Printf("watcher error: %s", err) },
+		done:    make(chan struct{}),
+	}
 }
 
-func (bw *BuildWatcher) Watch() (chan struct{}, error) {
-	eventC := make(chan struct{})
-	if err := bw.watchFolders(); err != nil {
+// Delay sets the quiet period which merges a burst of file system events
+// into a single change report
+func (bw *BuildWatcher) Delay(delay time.Duration) *BuildWatcher {
+	if delay > 0 {
+		bw.delay = delay
+	}
+	return bw
+}
+
+// Ignore sets the matcher of paths which are not watched,
+// only ignore.DefaultPatterns are excluded by default
+func (bw *BuildWatcher) Ignore(matcher *ignore.Matcher) *BuildWatcher {
+	bw.ignore = matcher
+	return bw
+}
+
+// OnError sets the handler of watcher errors, they are logged by default
+func (bw *BuildWatcher) OnError(handler func(error)) *BuildWatcher {
+	bw.onError = handler
+	return bw
+}
+
+// Close stops watching and closes the channel returned by Watch, changes
+// which were not reported yet are dropped. It is safe to call Close more than once
+func (bw *BuildWatcher) Close() error {
+	var err error
+	bw.closeOnce.Do(func() {
+		close(bw.done)
+		if bw.Watcher != nil {
+			err = bw.Watcher.Close()
+		}
+	})
+	return err
+}
+
+// Watch reports changes made during each burst of file system events,
+// one event per path sorted by path
+func (bw *BuildWatcher) Watch() (chan []Event, error) {
+	eventC := make(chan []Event)
+	var snapshot map[string]fileState
+	var err error
+	if bw.pollInterval > 0 {
+		snapshot, err = bw.scan()
+	} else if bw.Watcher, err = fsnotify.NewWatcher(); err == nil {
+		err = bw.watchFolders()
+	}
+	if err != nil {
 		return nil, err
 	}
+	changes := make(chan Event)
+	go bw.debounce(changes, eventC)
+	var wg sync.WaitGroup
+	if snapshot != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bw.poll(changes, snapshot)
+		}()
+	} else {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			bw.watchEvents(changes)
+		}()
+		go func() {
+			defer wg.Done()
+			bw.watchErrors(changes)
+		}()
+	}
 	go func() {
-		for event := range bw.Watcher.Events {
-			if event.Op&fsnotify.Create != 0 && !strings.HasSuffix(event.Name, "~") {
-				if err := bw.Watcher.Add(event.Name); err != nil {
-					log.Printf("error add path %s to watch: %s", event.Name, err)
-				}
+		wg.Wait()
+		close(changes)
+	}()
+	return eventC, nil
+}
+
+func (bw *BuildWatcher) watchEvents(changes chan<- Event) {
+	for event := range bw.Watcher.Events {
+		isDir := false
+		if info, err := os.Stat(event.Name); err == nil {
+			isDir = info.IsDir()
+		}
+		if bw.ignore.Match(event.Name, isDir) {
+			continue
+		}
+		if event.Op&fsnotify.Create != 0 {
+			if err := bw.Watcher.Add(event.Name); err != nil {
+				log.Printf("error add path %s to watch: %s", event.Name, err)
 			}
-			if event.Op&fsnotify.Remove != 0 && !strings.HasSuffix(event.Name, "~") {
-				if err := bw.Watcher.Remove(event.Name); err != nil {
-					log.Printf("error remove path %s to watch: %s", event.Name, err)
+		}
+		if event.Op&fsnotify.Remove != 0 {
+			if err := bw.Watcher.Remove(event.Name); err != nil {
+				log.Printf("error remove path %s to watch: %s", event.Name, err)
+			}
+		}
+		if op := fromFSNotify(event.Op); op != 0 {
+			if !bw.send(changes, Event{
+				Path: event.Name,
+				Op:   op,
+				Root: bw.rootOf(event.Name),
+			}) {
+				return
+			}
+		}
+	}
+}
+
+// watchErrors reports watcher errors. Events are lost on queue overflow, so
+// the watches are re-registered and every source root is reported as changed
+func (bw *BuildWatcher) watchErrors(changes chan<- Event) {
+	for err := range bw.Watcher.Errors {
+		bw.onError(err)
+		if err != fsnotify.ErrEventOverflow {
+			continue
+		}
+		if err := bw.watchFolders(); err != nil {
+			bw.onError(fmt.Errorf("error re-scanning source directories: %s", err))
+		}
+		for _, root := range bw.paths {
+			if !bw.send(changes, Event{Path: root, Op: Rescan, Root: root}) {
+				return
+			}
+		}
+	}
+}
+
+// send reports false if the watcher was closed before the event was accepted
+func (bw *BuildWatcher) send(changes chan<- Event, event Event) bool {
+	select {
+	case changes <- event:
+		return true
+	case <-bw.done:
+		return false
+	}
+}
+
+// debounce collects changes until no new changes arrive for the delay
+// period and then sends them as one batch, merging operations on the same path
+func (bw *BuildWatcher) debounce(changes <-chan Event, eventC chan<- []Event) {
+	defer close(eventC)
+	pending := make(map[string]Event)
+	timer := time.NewTimer(bw.delay)
+	timer.Stop()
+	for {
+		select {
+		case event, ok := <-changes:
+			if !ok {
+				timer.Stop()
+				return
+			}
+			if prev, ok := pending[event.Path]; ok {
+				event.Op |= prev.Op
+			}
+			pending[event.Path] = event
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
 				}
 			}
-			if event.Op&fsnotify.Chmod == 0 {
-				eventC <- struct{}{}
+			timer.Reset(bw.delay)
+		case <-timer.C:
+			events := make([]Event, 0, len(pending))
+			for _, event := range pending {
+				events = append(events, event)
+			}
+			sort.Slice(events, func(i, j int) bool { return events[i].Path < events[j].Path })
+			pending = make(map[string]Event)
+			select {
+			case eventC <- events:
+			case <-bw.done:
+				return
 			}
 		}
-	}()
-	return eventC, nil
+	}
 }
 
 func (bw *BuildWatcher) watchFolders() error {
@@ -57,6 +224,9 @@ func (bw *BuildWatcher) watchFolders() error {
 				return err
 			}
 			if info.IsDir() {
+				if newPath != path && bw.ignore.Match(newPath, true) {
+					return filepath.SkipDir
+				}
 				log.Printf("Start watching files in directory: %s", newPath)
 				err := bw.Watcher.Add(newPath)
 				if err != nil {
@@ -0,0 +1,151 @@
+package watcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchDebounce(t *testing.T) {
+	root := t.TempDir()
+	bw := NewBuildWatcher([]string{root})
+	events, err := bw.Delay(50 * time.Millisecond).Watch()
+	if !assert.NoError(t, err) {
+		return
+	}
+	var expected []Event
+	for _, name := range []string{"a.js", "b.js", "c.html"} {
+		path := filepath.Join(root, name)
+		expected = append(expected, Event{Path: path, Op: Create | Write, Root: root})
+		if !assert.NoError(t, ioutil.WriteFile(path, []byte(name), 0640)) {
+			return
+		}
+	}
+	select {
+	case changes := <-events:
+		assert.Equal(t, expected, changes)
+	case <-time.After(time.Second):
+		assert.Fail(t, "no change reported")
+	}
+	select {
+	case changes := <-events:
+		assert.Fail(t, "unexpected change reported", "%v", changes)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestEventRoot(t *testing.T) {
+	bw := &BuildWatcher{paths: []string{"/project/scripts", "/project/scripts-legacy", "/project"}}
+	testCases := map[string]string{
+		"/project/scripts/app.ts":        "/project/scripts",
+		"/project/scripts-legacy/app.js": "/project/scripts-legacy",
+		"/project/index.html":            "/project",
+		"/other/index.html":              "",
+	}
+	for path, root := range testCases {
+		assert.Equal(t, root, bw.rootOf(path), path)
+	}
+	assert.Equal(t, "CREATE|WRITE", (Create | Write).String())
+}
+
+func TestWatchClose(t *testing.T) {
+	bw := NewBuildWatcher([]string{t.TempDir()})
+	events, err := bw.Watch()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, bw.Close())
+	assert.NoError(t, bw.Close())
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		assert.Fail(t, "events channel is not closed")
+	}
+}
+
+func TestWatchOverflow(t *testing.T) {
+	root := t.TempDir()
+	bw := NewBuildWatcher([]string{root})
+	defer func() { _ = bw.Close() }()
+	errs := make(chan error, 1)
+	events, err := bw.Delay(10 * time.Millisecond).OnError(func(err error) { errs <- err }).Watch()
+	if !assert.NoError(t, err) {
+		return
+	}
+	bw.Watcher.Errors <- fsnotify.ErrEventOverflow
+	assert.Equal(t, fsnotify.ErrEventOverflow, <-errs)
+	select {
+	case changes := <-events:
+		assert.Equal(t, []Event{{Path: root, Op: Rescan, Root: root}}, changes)
+	case <-time.After(time.Second):
+		assert.Fail(t, "no rescan reported")
+	}
+}
+
+func TestWatchIgnored(t *testing.T) {
+	root := t.TempDir()
+	bw := NewBuildWatcher([]string{root})
+	defer func() { _ = bw.Close() }()
+	events, err := bw.Delay(20 * time.Millisecond).Watch()
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, name := range []string{".app.js.swp", "app.js~", "app.js"} {
+		if !assert.NoError(t, ioutil.WriteFile(filepath.Join(root, name), []byte(name), 0640)) {
+			return
+		}
+	}
+	select {
+	case changes := <-events:
+		assert.Equal(t, []Event{{Path: filepath.Join(root, "app.js"), Op: Create | Write, Root: root}}, changes)
+	case <-time.After(time.Second):
+		assert.Fail(t, "no change reported")
+	}
+}
+
+func TestWatchPoll(t *testing.T) {
+	root := t.TempDir()
+	existing := filepath.Join(root, "existing.js")
+	if !assert.NoError(t, ioutil.WriteFile(existing, []byte("1"), 0640)) {
+		return
+	}
+	bw := NewBuildWatcher([]string{root})
+	defer func() { _ = bw.Close() }()
+	events, err := bw.Delay(20 * time.Millisecond).Poll(10 * time.Millisecond).Watch()
+	if !assert.NoError(t, err) {
+		return
+	}
+	// no file system watches are registered while polling
+	assert.Nil(t, bw.Watcher)
+	created := filepath.Join(root, "created.js")
+	if !assert.NoError(t, ioutil.WriteFile(created, []byte("2"), 0640)) {
+		return
+	}
+	if !assert.NoError(t, ioutil.WriteFile(existing, []byte("11"), 0640)) {
+		return
+	}
+	select {
+	case changes := <-events:
+		assert.Equal(t, []Event{
+			{Path: created, Op: Create, Root: root},
+			{Path: existing, Op: Write, Root: root},
+		}, changes)
+	case <-time.After(time.Second):
+		assert.Fail(t, "no change reported")
+	}
+	if !assert.NoError(t, os.Remove(created)) {
+		return
+	}
+	select {
+	case changes := <-events:
+		assert.Equal(t, []Event{{Path: created, Op: Remove, Root: root}}, changes)
+	case <-time.After(time.Second):
+		assert.Fail(t, "no change reported")
+	}
+}